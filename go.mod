@@ -11,3 +11,7 @@ require (
 require golang.org/x/crypto v0.39.0
 
 require github.com/golang-jwt/jwt/v5 v5.2.2
+
+require github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+
+require golang.org/x/sys v0.33.0 // indirect
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -10,8 +14,13 @@ import (
 	"github.com/google/uuid"
 	"github.com/marekmchl/Chirpy/internal/auth"
 	"github.com/marekmchl/Chirpy/internal/database"
+	"github.com/marekmchl/Chirpy/internal/mail"
+	"github.com/marekmchl/Chirpy/internal/passwordpolicy"
+	"github.com/marekmchl/Chirpy/internal/subscription"
 )
 
+const refreshTokenDuration = time.Duration(1 * time.Hour)
+
 func (cfg *apiConfig) handlerGetMetrics(w http.ResponseWriter, r *http.Request) {
 	messageHTML := `<html>
   <body>
@@ -44,17 +53,17 @@ func (cfg *apiConfig) handlerResetMetrics(w http.ResponseWriter, r *http.Request
 	w.Write([]byte("OK"))
 }
 
-func replaceProfanities(s string) string {
-	profaneWords := []string{"kerfuffle", "sharbert", "fornax"}
-	chirpWords := strings.Split(s, " ")
-	for i, chirpWord := range chirpWords {
-		for _, profaneWord := range profaneWords {
-			if strings.ToLower(chirpWord) == profaneWord {
-				chirpWords[i] = "****"
-			}
-		}
+func (cfg *apiConfig) handlerReloadProfanity(w http.ResponseWriter, r *http.Request) {
+	if err := cfg.loadProfanityWords(r.Context()); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed reloading the word list: %v", err))
+		return
 	}
-	return strings.Join(chirpWords, " ")
+
+	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(200)
+	w.Write(fmt.Appendf([]byte{}, "Loaded %d words", cfg.profanity.Len()))
 }
 
 func (cfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, r *http.Request) {
@@ -118,13 +127,13 @@ func (cfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, r *http.Request)
 	}
 
 	// user authorization
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
+	userDB := userFromContext(r.Context())
+	if !userDB.EmailVerifiedAt.Valid {
 		w.Header().Add("Content-Type", "application/json")
-		w.WriteHeader(500)
+		w.WriteHeader(403)
 		resBody, err := json.Marshal(
 			returnError{
-				Error: "Internal server error",
+				Error: "Verify your email address before posting chirps",
 			},
 		)
 		if err != nil {
@@ -134,13 +143,35 @@ func (cfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	tokenID, err := auth.ValidateJWT(token, cfg.secret)
+	// moderation
+	moderated, err := cfg.moderation.Run(r.Context(), oneChirp.Body)
 	if err != nil {
 		w.Header().Add("Content-Type", "application/json")
-		w.WriteHeader(401)
+		w.WriteHeader(500)
 		resBody, err := json.Marshal(
 			returnError{
-				Error: "Unauthorized",
+				Error: "Internal server error",
+			},
+		)
+		if err != nil {
+			resBody = []byte{}
+		}
+		w.Write(resBody)
+		return
+	}
+	if moderated.Rejected {
+		type returnRejection struct {
+			Error  string `json:"error"`
+			Stage  string `json:"stage"`
+			Reason string `json:"reason"`
+		}
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(422)
+		resBody, err := json.Marshal(
+			returnRejection{
+				Error:  "Chirp rejected by moderation",
+				Stage:  moderated.Stage,
+				Reason: moderated.Reason,
 			},
 		)
 		if err != nil {
@@ -151,9 +182,14 @@ func (cfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, r *http.Request)
 	}
 
 	// is valid -> create chirp
+	// held chirps stay hidden until a moderator approves them
+	held := len(moderated.HeldBy) > 0
 	dbChirp, err := cfg.db.CreateChirp(r.Context(), database.CreateChirpParams{
-		Body:   replaceProfanities(oneChirp.Body),
-		UserID: tokenID,
+		Body:       moderated.Body,
+		UserID:     userDB.ID,
+		Flagged:    held,
+		HeldBy:     sql.NullString{String: strings.Join(moderated.HeldBy, ","), Valid: held},
+		HoldReason: sql.NullString{String: strings.Join(moderated.HoldReasons, "; "), Valid: held},
 	})
 	if err != nil {
 		w.Header().Add("Content-Type", "application/json")
@@ -171,18 +207,20 @@ func (cfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, r *http.Request)
 	}
 
 	type resChirpStruct struct {
-		ID        uuid.UUID `json:"id"`
-		CreatedAt time.Time `json:"created_at"`
-		UpdatedAt time.Time `json:"updated_at"`
-		Body      string    `json:"body"`
-		UserID    uuid.UUID `json:"user_id"`
+		ID            uuid.UUID `json:"id"`
+		CreatedAt     time.Time `json:"created_at"`
+		UpdatedAt     time.Time `json:"updated_at"`
+		Body          string    `json:"body"`
+		UserID        uuid.UUID `json:"user_id"`
+		PendingReview bool      `json:"pending_review"`
 	}
 	respVals := resChirpStruct{
-		ID:        dbChirp.ID,
-		CreatedAt: dbChirp.CreatedAt,
-		UpdatedAt: dbChirp.UpdatedAt,
-		Body:      dbChirp.Body,
-		UserID:    dbChirp.UserID,
+		ID:            dbChirp.ID,
+		CreatedAt:     dbChirp.CreatedAt,
+		UpdatedAt:     dbChirp.UpdatedAt,
+		Body:          dbChirp.Body,
+		UserID:        dbChirp.UserID,
+		PendingReview: dbChirp.Flagged,
 	}
 	resBody, err := json.Marshal(respVals)
 	if err != nil {
@@ -193,6 +231,34 @@ func (cfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, r *http.Request)
 	w.Write(resBody)
 }
 
+// checkPasswordPolicy responds with 422 and the rules password failed if
+// the user with this email may not use it.
+func (cfg *apiConfig) checkPasswordPolicy(w http.ResponseWriter, password, email string) bool {
+	violations := cfg.passwordPolicy.Check(password, email)
+	if len(violations) == 0 {
+		return true
+	}
+
+	type policyError struct {
+		Error       string                     `json:"error"`
+		FailedRules []passwordpolicy.Violation `json:"failed_rules"`
+	}
+	errorJson, err := json.Marshal(policyError{
+		Error:       "Password doesn't meet the requirements",
+		FailedRules: violations,
+	})
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed marshalling the response body: %v", err))
+		return false
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(422)
+	w.Write(errorJson)
+	return false
+}
+
 func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request) {
 	type emailStruct struct {
 		Password string `json:"password"`
@@ -207,6 +273,14 @@ func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	email, ok := cfg.checkNewEmail(w, r, reqData.Email, uuid.Nil)
+	if !ok {
+		return
+	}
+	if !cfg.checkPasswordPolicy(w, reqData.Password, email) {
+		return
+	}
+
 	hashedPassword, err := auth.HashPassword(reqData.Password)
 	if err != nil {
 		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
@@ -216,8 +290,14 @@ func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request)
 	}
 	rawUser, err := cfg.db.CreateUser(r.Context(), database.CreateUserParams{
 		HashedPassword: hashedPassword,
-		Email:          reqData.Email,
+		Email:          email,
 	})
+	if isUniqueViolation(err) {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(409)
+		w.Write([]byte("Email is already in use"))
+		return
+	}
 	if err != nil {
 		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
 		w.WriteHeader(500)
@@ -225,19 +305,27 @@ func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// the account exists either way, a failed send can be retried with
+	// POST /api/users/verify
+	if err := cfg.sendVerificationEmail(r.Context(), rawUser); err != nil {
+		log.Printf("failed sending the verification email to user %v: %v", rawUser.ID, err)
+	}
+
 	type userStruct struct {
-		ID          uuid.UUID `json:"id"`
-		CreatedAt   time.Time `json:"created_at"`
-		UpdatedAt   time.Time `json:"updated_at"`
-		Email       string    `json:"email"`
-		IsChirpyRed bool      `json:"is_chirpy_red"`
+		ID            uuid.UUID `json:"id"`
+		CreatedAt     time.Time `json:"created_at"`
+		UpdatedAt     time.Time `json:"updated_at"`
+		Email         string    `json:"email"`
+		EmailVerified bool      `json:"email_verified"`
+		IsChirpyRed   bool      `json:"is_chirpy_red"`
 	}
 	user := userStruct{
-		ID:          rawUser.ID,
-		CreatedAt:   rawUser.CreatedAt,
-		UpdatedAt:   rawUser.UpdatedAt,
-		Email:       rawUser.Email,
-		IsChirpyRed: false,
+		ID:            rawUser.ID,
+		CreatedAt:     rawUser.CreatedAt,
+		UpdatedAt:     rawUser.UpdatedAt,
+		Email:         rawUser.Email,
+		EmailVerified: false,
+		IsChirpyRed:   false,
 	}
 	userJson, err := json.Marshal(user)
 	if err != nil {
@@ -261,7 +349,11 @@ func (cfg *apiConfig) handlerGetAllChirps(w http.ResponseWriter, r *http.Request
 		UserID    uuid.UUID `json:"user_id"`
 	}
 
-	dbChirps, err := cfg.db.GetAllChirps(r.Context())
+	getChirps := cfg.db.GetAllChirps
+	if cfg.hideSuspendedChirps {
+		getChirps = cfg.db.GetAllChirpsFromActiveUsers
+	}
+	dbChirps, err := getChirps(r.Context())
 	if err != nil {
 		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
 		w.WriteHeader(500)
@@ -308,8 +400,12 @@ func (cfg *apiConfig) handlerGetChirp(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("Internal Server Error"))
 		return
 	}
-	dbChirp, err := cfg.db.GetChirpByID(r.Context(), reqID)
-	if err != nil {
+	getChirp := cfg.db.GetChirpByID
+	if cfg.hideSuspendedChirps {
+		getChirp = cfg.db.GetChirpByIDFromActiveUser
+	}
+	dbChirp, err := getChirp(r.Context(), reqID)
+	if err != nil || dbChirp.Flagged || dbChirp.Hidden {
 		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
 		w.WriteHeader(404)
 		w.Write([]byte("Chirp not found"))
@@ -351,26 +447,98 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userDB, err := cfg.db.GetUserByEmail(r.Context(), reqData.Email)
+	ip := clientIP(r)
+	now := time.Now()
+	if wait, ok := cfg.ipLoginThrottle.Allow(ip, now); !ok {
+		respondWithTooManyAttempts(w, wait, "Too many failed logins, try again later")
+		return
+	}
+
+	userDB, err := cfg.db.GetUserByEmail(r.Context(), strings.ToLower(strings.TrimSpace(reqData.Email)))
 	if err != nil {
+		cfg.ipLoginThrottle.Failure(ip, now)
 		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
 		w.WriteHeader(401)
 		w.Write([]byte("Incorrect email or password"))
 		return
 	}
 
+	// the attempt counts before the password is checked, so concurrent
+	// guesses can't slip past the backoff, and the password isn't checked at
+	// all while the account has to wait, so guesses during a lockout reveal
+	// nothing
+	userDB, wait, err := claimLoginAttempt(r.Context(), cfg.db, cfg.accountLoginPolicy, userDB)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed counting the login attempt: %v", err))
+		return
+	}
+	if wait > 0 {
+		if cfg.accountLoginPolicy.Locked(int(userDB.FailedLoginAttempts)) {
+			respondWithTooManyAttempts(w, wait, "Account is temporarily locked after too many failed logins")
+			return
+		}
+		respondWithTooManyAttempts(w, wait, "Too many failed logins, try again later")
+		return
+	}
+
 	if err := auth.CheckPasswordHash(userDB.HashedPassword, reqData.Password); err != nil {
+		cfg.ipLoginThrottle.Failure(ip, now)
+		recordFailedLogin(cfg.accountLoginPolicy, userDB)
 		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
 		w.WriteHeader(401)
 		w.Write([]byte("Incorrect email or password"))
 		return
 	}
+	rehashPasswordIfNeeded(r.Context(), cfg.db, userDB, reqData.Password)
+
+	if restriction := accountRestriction(userDB.Banned, userDB.SuspendedUntil); restriction != "" {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(403)
+		w.Write([]byte(restriction))
+		return
+	}
+
+	// with 2FA the failures are only forgotten once the code is right too,
+	// so logging in again doesn't buy more guesses
+	if userDB.TotpEnabled {
+		cfg.respondWithLoginChallenge(w, r, userDB)
+		return
+	}
+
+	resetFailedLogins(r.Context(), cfg.db, userDB)
+	cfg.respondWithLoginTokens(w, r, userDB)
+}
+
+// rehashPasswordIfNeeded upgrades the stored hash of a password that was
+// just checked to the current algorithm and costs. Failing to do so doesn't
+// stop the login.
+func rehashPasswordIfNeeded(ctx context.Context, db *database.Queries, userDB database.User, password string) {
+	if !auth.PasswordNeedsRehash(userDB.HashedPassword) {
+		return
+	}
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		log.Printf("failed rehashing the password of user %v: %v", userDB.ID, err)
+		return
+	}
+	if err := db.RehashPasswordUserWithID(ctx, database.RehashPasswordUserWithIDParams{
+		ID:             userDB.ID,
+		HashedPassword: hashedPassword,
+	}); err != nil {
+		log.Printf("failed saving the rehashed password of user %v: %v", userDB.ID, err)
+	}
+}
 
-	token, err := auth.MakeJWT(userDB.ID, cfg.secret, time.Duration(10*time.Minute))
+// respondWithLoginTokens starts a new session for the user and responds with
+// its access and refresh tokens.
+func (cfg *apiConfig) respondWithLoginTokens(w http.ResponseWriter, r *http.Request, userDB database.User) {
+	token, err := auth.MakeJWT(userDB.ID, userDB.Role, cfg.keys, cfg.jwtAudience, time.Duration(10*time.Minute))
 	if err != nil {
 		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
-		w.WriteHeader(401)
-		w.Write([]byte("Incorrect email or password"))
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed making the access token: %v", err))
 		return
 	}
 
@@ -381,29 +549,40 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("Internal server error - failed to make refresh token"))
 		return
 	}
-	cfg.db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-		Token:     refreshTokenString,
-		UserID:    userDB.ID,
-		ExpiresAt: time.Now().Add(time.Duration(1 * time.Hour)),
-	})
+	if _, err := cfg.db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		TokenHash:   auth.HashRefreshToken(refreshTokenString),
+		TokenPrefix: auth.RefreshTokenPrefix(refreshTokenString),
+		UserID:      userDB.ID,
+		ExpiresAt:   time.Now().Add(refreshTokenDuration),
+		FamilyID:    uuid.New(),
+		UserAgent:   r.UserAgent(),
+		IpAddress:   clientIP(r),
+	}); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed saving the refresh token: %v", err))
+		return
+	}
 
 	type userStruct struct {
-		ID           uuid.UUID `json:"id"`
-		CreatedAt    time.Time `json:"created_at"`
-		UpdatedAt    time.Time `json:"updated_at"`
-		Email        string    `json:"email"`
-		Token        string    `json:"token"`
-		RefreshToken string    `json:"refresh_token"`
-		IsChirpyRed  bool      `json:"is_chirpy_red"`
+		ID                uuid.UUID `json:"id"`
+		CreatedAt         time.Time `json:"created_at"`
+		UpdatedAt         time.Time `json:"updated_at"`
+		Email             string    `json:"email"`
+		Token             string    `json:"token"`
+		RefreshToken      string    `json:"refresh_token"`
+		IsChirpyRed       bool      `json:"is_chirpy_red"`
+		DeletionCancelled bool      `json:"deletion_cancelled,omitempty"`
 	}
 	user := userStruct{
-		ID:           userDB.ID,
-		CreatedAt:    userDB.CreatedAt,
-		UpdatedAt:    userDB.UpdatedAt,
-		Email:        userDB.Email,
-		Token:        token,
-		RefreshToken: refreshTokenString,
-		IsChirpyRed:  userDB.IsChirpyRed,
+		ID:                userDB.ID,
+		CreatedAt:         userDB.CreatedAt,
+		UpdatedAt:         userDB.UpdatedAt,
+		Email:             userDB.Email,
+		Token:             token,
+		RefreshToken:      refreshTokenString,
+		IsChirpyRed:       userDB.IsChirpyRed,
+		DeletionCancelled: cancelAccountDeletion(r.Context(), cfg.db, userDB),
 	}
 
 	userJson, err := json.Marshal(user)
@@ -416,7 +595,22 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "application/json")
 	w.WriteHeader(200)
 	w.Write(userJson)
-	return
+}
+
+// getRefreshToken finds the stored refresh token matching a token presented
+// by a client. Only the prefix is used in the query, the hash is compared
+// in constant time.
+func (cfg *apiConfig) getRefreshToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	candidates, err := cfg.db.GetRefreshTokensByPrefix(ctx, auth.RefreshTokenPrefix(token))
+	if err != nil {
+		return database.RefreshToken{}, err
+	}
+	for _, candidate := range candidates {
+		if auth.CheckRefreshTokenHash(candidate.TokenHash, token) {
+			return candidate, nil
+		}
+	}
+	return database.RefreshToken{}, sql.ErrNoRows
 }
 
 func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
@@ -428,21 +622,38 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	refreshToken, err := cfg.db.GetRefreshTokenByToken(r.Context(), refreshTokenString)
+	refreshToken, err := cfg.getRefreshToken(r.Context(), refreshTokenString)
 	if err != nil {
 		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
 		w.WriteHeader(401)
 		w.Write([]byte("Unauthorized Request"))
 		return
 	}
-	if refreshToken.RevokedAt.Valid {
+	// tokens of OAuth clients are refreshed at /oauth/token, within their scopes
+	if refreshToken.RevokedAt.Valid || refreshToken.ExpiresAt.Before(time.Now()) || refreshToken.ClientID.Valid {
 		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
 		w.WriteHeader(401)
 		w.Write([]byte("Unauthorized Request"))
 		return
 	}
 
-	user, err := cfg.db.GetUserFromRefreshToken(r.Context(), refreshToken.Token)
+	// everything that can refuse the refresh comes before the rotation, so
+	// a refused token isn't used up and its retry doesn't look like reuse
+	user, err := cfg.db.GetUserFromRefreshToken(r.Context(), refreshToken.TokenHash)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write([]byte("Internal Server Error"))
+		return
+	}
+	if restriction := accountRestriction(user.Banned, user.SuspendedUntil); restriction != "" {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(403)
+		w.Write([]byte(restriction))
+		return
+	}
+
+	accessToken, err := auth.MakeJWT(user.ID, user.Role, cfg.keys, cfg.jwtAudience, time.Duration(1*time.Hour))
 	if err != nil {
 		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
 		w.WriteHeader(500)
@@ -450,7 +661,7 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	accessToken, err := auth.MakeJWT(user.ID, cfg.secret, time.Duration(1*time.Hour))
+	newRefreshTokenString, err := auth.MakeRefreshToken()
 	if err != nil {
 		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
 		w.WriteHeader(500)
@@ -458,10 +669,51 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// a token that was already rotated is being replayed, so whoever holds
+	// the family can no longer be trusted
+	if _, err := cfg.db.RotateRefreshToken(r.Context(), database.RotateRefreshTokenParams{
+		TokenHash:  refreshToken.TokenHash,
+		ReplacedBy: sql.NullString{String: auth.HashRefreshToken(newRefreshTokenString), Valid: true},
+	}); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(500)
+			w.Write([]byte("Internal Server Error"))
+			return
+		}
+		if err := cfg.db.RevokeRefreshTokenFamily(r.Context(), refreshToken.FamilyID); err != nil {
+			log.Printf("security: failed revoking refresh token family %v: %v", refreshToken.FamilyID, err)
+		}
+		log.Printf("security: refresh token reuse detected for user %v, revoked token family %v", refreshToken.UserID, refreshToken.FamilyID)
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(401)
+		w.Write([]byte("Unauthorized Request"))
+		return
+	}
+
+	if _, err := cfg.db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		TokenHash:   auth.HashRefreshToken(newRefreshTokenString),
+		TokenPrefix: auth.RefreshTokenPrefix(newRefreshTokenString),
+		UserID:      user.ID,
+		ExpiresAt:   time.Now().Add(refreshTokenDuration),
+		FamilyID:    refreshToken.FamilyID,
+		UserAgent:   r.UserAgent(),
+		IpAddress:   clientIP(r),
+	}); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write([]byte("Internal Server Error"))
+		return
+	}
+
 	type returnTokenType struct {
-		Token string `json:"token"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	returnToken := returnTokenType{
+		Token:        accessToken,
+		RefreshToken: newRefreshTokenString,
 	}
-	returnToken := returnTokenType{Token: accessToken}
 
 	tokenJson, err := json.Marshal(returnToken)
 	if err != nil {
@@ -485,7 +737,7 @@ func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := cfg.db.RevokeRefreshToken(r.Context(), refreshTokenString); err != nil {
+	if err := cfg.db.RevokeRefreshToken(r.Context(), auth.HashRefreshToken(refreshTokenString)); err != nil {
 		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
 		w.WriteHeader(500)
 		w.Write(fmt.Appendf([]byte{}, "Internal Server Error - %v", err))
@@ -495,70 +747,78 @@ func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(204)
 }
 
+// handlerUpdateUser changes only the fields present in the body. Changing
+// the email or password takes the current password, and a new email only
+// replaces the old one once confirmed from the new address.
 func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request) {
-	reqJWT, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
-		w.WriteHeader(401)
-		w.Write(fmt.Appendf([]byte{}, "Failed reading token from header: %v", err))
-		return
-	}
-	reqUserID, err := auth.ValidateJWT(reqJWT, cfg.secret)
-	if err != nil {
-		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
-		w.WriteHeader(401)
-		w.Write(fmt.Appendf([]byte{}, "Failed reading token from header: %v", err))
-		return
-	}
+	reqUserID := userIDFromContext(r.Context())
 
-	type passAndEmail struct {
-		Password string `json:"password"`
-		Email    string `json:"email"`
+	type userPatch struct {
+		Email           *string `json:"email"`
+		Password        *string `json:"password"`
+		CurrentPassword string  `json:"current_password"`
 	}
 
 	decoder := json.NewDecoder(r.Body)
-	reqData := passAndEmail{}
+	reqData := userPatch{}
 	if err := decoder.Decode(&reqData); err != nil {
 		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
-		w.WriteHeader(401)
+		w.WriteHeader(400)
 		w.Write(fmt.Appendf([]byte{}, "Failed decoding data: %v", err))
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(reqData.Password)
+	dbUser, err := cfg.db.GetUserByID(r.Context(), reqUserID)
 	if err != nil {
 		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
 		w.WriteHeader(500)
-		w.Write(fmt.Appendf([]byte{}, "Failed hashing the password: %v", err))
+		w.Write(fmt.Appendf([]byte{}, "Failed getting the user: %v", err))
 		return
 	}
 
-	dbUser, err := cfg.db.UpdateUserWithID(r.Context(), database.UpdateUserWithIDParams{
-		ID:             reqUserID,
-		HashedPassword: hashedPassword,
-		Email:          reqData.Email,
-	})
-	if err != nil {
-		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
-		w.WriteHeader(500)
-		w.Write(fmt.Appendf([]byte{}, "Failed updating the user credentials: %v", err))
-		return
+	// sending the unchanged email back isn't a change
+	newEmail := ""
+	if reqData.Email != nil {
+		if normalized, _ := mail.NormalizeAddress(*reqData.Email); normalized != dbUser.Email {
+			newEmail = *reqData.Email
+		}
+	}
+	if newEmail != "" || reqData.Password != nil {
+		if !cfg.checkCurrentPassword(w, r, dbUser, reqData.CurrentPassword) {
+			return
+		}
+	}
+	if reqData.Password != nil {
+		updated, ok := cfg.changePassword(w, r, dbUser, *reqData.Password)
+		if !ok {
+			return
+		}
+		dbUser = updated
+	}
+	pendingEmail := dbUser.PendingEmail.String
+	if newEmail != "" {
+		if !cfg.requestEmailChange(w, r, dbUser, newEmail) {
+			return
+		}
+		pendingEmail, _ = mail.NormalizeAddress(newEmail)
 	}
 
 	type userInfo struct {
-		ID          uuid.UUID `json:"id"`
-		CreatedAt   time.Time `json:"created_at"`
-		UpdatedAt   time.Time `json:"updated_at"`
-		Email       string    `json:"email"`
-		IsChirpyRed bool      `json:"is_chirpy_red"`
+		ID           uuid.UUID `json:"id"`
+		CreatedAt    time.Time `json:"created_at"`
+		UpdatedAt    time.Time `json:"updated_at"`
+		Email        string    `json:"email"`
+		PendingEmail string    `json:"pending_email,omitempty"`
+		IsChirpyRed  bool      `json:"is_chirpy_red"`
 	}
 
 	user := userInfo{
-		ID:          dbUser.ID,
-		CreatedAt:   dbUser.CreatedAt,
-		UpdatedAt:   dbUser.UpdatedAt,
-		Email:       dbUser.Email,
-		IsChirpyRed: dbUser.IsChirpyRed,
+		ID:           dbUser.ID,
+		CreatedAt:    dbUser.CreatedAt,
+		UpdatedAt:    dbUser.UpdatedAt,
+		Email:        dbUser.Email,
+		PendingEmail: pendingEmail,
+		IsChirpyRed:  dbUser.IsChirpyRed,
 	}
 
 	userJson, err := json.Marshal(user)
@@ -574,21 +834,7 @@ func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request)
 }
 
 func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request) {
-	reqJWT, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
-		w.WriteHeader(401)
-		w.Write(fmt.Appendf([]byte{}, "Failed getting token: %v", err))
-		return
-	}
-
-	reqUserID, err := auth.ValidateJWT(reqJWT, cfg.secret)
-	if err != nil {
-		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
-		w.WriteHeader(403)
-		w.Write(fmt.Appendf([]byte{}, "Token invalid"))
-		return
-	}
+	reqUserID := userIDFromContext(r.Context())
 
 	reqID, err := uuid.Parse(r.PathValue("chirpID"))
 	if err != nil {
@@ -640,10 +886,15 @@ func (cfg *apiConfig) handlerPolkaWebhook(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// id and created_at are optional, without them redeliveries can't be
+	// told apart and events are ordered by when they arrive
 	type requestBody struct {
-		Event string `json:"event"`
-		Data  struct {
-			UserID string `json:"user_id"`
+		ID        string     `json:"id"`
+		Event     string     `json:"event"`
+		CreatedAt *time.Time `json:"created_at"`
+		Data      struct {
+			UserID           string     `json:"user_id"`
+			CurrentPeriodEnd *time.Time `json:"current_period_end"`
 		} `json:"data"`
 	}
 
@@ -656,7 +907,7 @@ func (cfg *apiConfig) handlerPolkaWebhook(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	if reqData.Event != "user.upgraded" {
+	if !subscription.IsEvent(reqData.Event) {
 		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
 		w.WriteHeader(204)
 		w.Write(fmt.Appendf([]byte{}, "Request carried out successfully"))
@@ -671,11 +922,31 @@ func (cfg *apiConfig) handlerPolkaWebhook(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	_, err = cfg.db.PromoteToRedUserWithID(r.Context(), userID)
-	if err != nil {
+	_, err = cfg.db.GetUserByID(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
 		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
 		w.WriteHeader(404)
-		w.Write(fmt.Appendf([]byte{}, "Failed updating user: %v", err))
+		w.Write([]byte("User not found"))
+		return
+	}
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed getting the user: %v", err))
+		return
+	}
+
+	event := subscription.Event{Name: reqData.Event, At: time.Now()}
+	if reqData.CreatedAt != nil {
+		event.At = *reqData.CreatedAt
+	}
+	if reqData.Data.CurrentPeriodEnd != nil {
+		event.PeriodEnd = *reqData.Data.CurrentPeriodEnd
+	}
+	if err := cfg.applySubscriptionEvent(r.Context(), reqData.ID, userID, event); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed updating the subscription: %v", err))
 		return
 	}
 
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/marekmchl/Chirpy/internal/database"
+)
+
+const (
+	defaultAccountDeletionGracePeriod = time.Duration(30 * 24 * time.Hour)
+	accountDeletionInterval           = time.Duration(1 * time.Hour)
+)
+
+// handlerDeleteAccount schedules the user's account for deletion after the
+// grace period and logs them out everywhere. Logging back in before then
+// cancels it.
+func (cfg *apiConfig) handlerDeleteAccount(w http.ResponseWriter, r *http.Request) {
+	reqUserID := userIDFromContext(r.Context())
+
+	type parameters struct {
+		Password string `json:"password"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "Failed decoding parameters: %v", err))
+		return
+	}
+
+	userDB, err := cfg.db.GetUserByID(r.Context(), reqUserID)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed getting the user: %v", err))
+		return
+	}
+	if !cfg.checkCurrentPassword(w, r, userDB, params.Password) {
+		return
+	}
+
+	userDB, err = cfg.db.RequestDeletionUserWithID(r.Context(), reqUserID)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed scheduling the deletion: %v", err))
+		return
+	}
+	if err := cfg.revokeAllCredentials(r.Context(), reqUserID); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed signing out everywhere: %v", err))
+		return
+	}
+
+	type deletionStruct struct {
+		DeletionScheduledAt time.Time `json:"deletion_scheduled_at"`
+	}
+	deletionJson, err := json.Marshal(deletionStruct{
+		DeletionScheduledAt: userDB.DeletionRequestedAt.Time.Add(cfg.accountDeletionGracePeriod),
+	})
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed marshalling the response body: %v", err))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(202)
+	w.Write(deletionJson)
+}
+
+// cancelAccountDeletion keeps the account of a user who logged back in
+// during the grace period. It reports whether a deletion was cancelled.
+func cancelAccountDeletion(ctx context.Context, db *database.Queries, userDB database.User) bool {
+	if !userDB.DeletionRequestedAt.Valid {
+		return false
+	}
+	if err := db.CancelDeletionUserWithID(ctx, userDB.ID); err != nil {
+		log.Printf("failed cancelling the deletion of user %v: %v", userDB.ID, err)
+		return false
+	}
+	return true
+}
+
+// deleteAccountsPeriodically deletes the accounts whose grace period is
+// over. Their chirps, tokens and other rows go with them through the
+// foreign keys.
+func (cfg *apiConfig) deleteAccountsPeriodically() {
+	ticker := time.NewTicker(accountDeletionInterval)
+	go func() {
+		for {
+			cutoff := time.Now().Add(-cfg.accountDeletionGracePeriod)
+			deleted, err := cfg.db.DeleteUsersRequestedBefore(context.Background(), sql.NullTime{Time: cutoff, Valid: true})
+			if err != nil {
+				log.Printf("failed deleting accounts: %v", err)
+			} else if deleted > 0 {
+				log.Printf("deleted %d accounts after their grace period", deleted)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/marekmchl/Chirpy/internal/auth"
+	"github.com/marekmchl/Chirpy/internal/database"
+	"github.com/marekmchl/Chirpy/internal/mail"
+)
+
+type adminUserStruct struct {
+	ID             uuid.UUID  `json:"id"`
+	Email          string     `json:"email"`
+	Role           string     `json:"role"`
+	Banned         bool       `json:"banned"`
+	SuspendedUntil *time.Time `json:"suspended_until,omitempty"`
+	FailedLogins   int32      `json:"failed_logins"`
+}
+
+func (cfg *apiConfig) handlerSuspendUser(w http.ResponseWriter, r *http.Request) {
+	type requestBody struct {
+		Days int    `json:"days"`
+		Note string `json:"note"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	reqData := requestBody{}
+	if err := decoder.Decode(&reqData); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "Failed decoding data: %v", err))
+		return
+	}
+	if reqData.Days <= 0 {
+		reqData.Days = defaultSuspensionDays
+	}
+
+	suspendedUntil := sql.NullTime{Time: time.Now().Add(time.Duration(reqData.Days) * 24 * time.Hour), Valid: true}
+	cfg.moderateUser(w, r, "suspend_user", reqData.Note, func(userID uuid.UUID) (database.User, error) {
+		return cfg.db.SuspendUserWithID(r.Context(), database.SuspendUserWithIDParams{
+			ID:             userID,
+			SuspendedUntil: suspendedUntil,
+		})
+	})
+}
+
+func (cfg *apiConfig) handlerUnsuspendUser(w http.ResponseWriter, r *http.Request) {
+	cfg.moderateUser(w, r, "unsuspend_user", "", func(userID uuid.UUID) (database.User, error) {
+		return cfg.db.SuspendUserWithID(r.Context(), database.SuspendUserWithIDParams{
+			ID: userID,
+		})
+	})
+}
+
+func (cfg *apiConfig) handlerBanUser(w http.ResponseWriter, r *http.Request) {
+	cfg.moderateUser(w, r, "ban_user", "", func(userID uuid.UUID) (database.User, error) {
+		return cfg.db.SetBannedUserWithID(r.Context(), database.SetBannedUserWithIDParams{
+			ID:     userID,
+			Banned: true,
+		})
+	})
+}
+
+func (cfg *apiConfig) handlerUnbanUser(w http.ResponseWriter, r *http.Request) {
+	cfg.moderateUser(w, r, "unban_user", "", func(userID uuid.UUID) (database.User, error) {
+		return cfg.db.SetBannedUserWithID(r.Context(), database.SetBannedUserWithIDParams{
+			ID:     userID,
+			Banned: false,
+		})
+	})
+}
+
+// handlerUnlockUser lifts a lockout after too many failed logins.
+func (cfg *apiConfig) handlerUnlockUser(w http.ResponseWriter, r *http.Request) {
+	cfg.moderateUser(w, r, "unlock_user", "", func(userID uuid.UUID) (database.User, error) {
+		return cfg.db.ResetFailedLoginsUserWithID(r.Context(), userID)
+	})
+}
+
+func (cfg *apiConfig) handlerSetUserRole(w http.ResponseWriter, r *http.Request) {
+	type requestBody struct {
+		Role string `json:"role"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	reqData := requestBody{}
+	if err := decoder.Decode(&reqData); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "Failed decoding data: %v", err))
+		return
+	}
+	if !auth.IsValidRole(reqData.Role) {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "'%v' is not one of user, moderator, admin", reqData.Role))
+		return
+	}
+
+	cfg.moderateUser(w, r, "set_role", reqData.Role, func(userID uuid.UUID) (database.User, error) {
+		return cfg.db.SetRoleUserWithID(r.Context(), database.SetRoleUserWithIDParams{
+			ID:   userID,
+			Role: reqData.Role,
+		})
+	})
+}
+
+// moderateUser applies update to the user named by the path, records it as
+// a moderation action and responds with the updated user. Only users of a
+// lower role than the caller can be moderated.
+func (cfg *apiConfig) moderateUser(w http.ResponseWriter, r *http.Request, action, note string, update func(uuid.UUID) (database.User, error)) {
+	moderatorID := userIDFromContext(r.Context())
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "Failed parsing the ID: %v", err))
+		return
+	}
+
+	target, err := cfg.db.GetUserByID(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(404)
+		w.Write(fmt.Appendf([]byte{}, "User with ID %v not found", userID))
+		return
+	}
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed getting the user: %v", err))
+		return
+	}
+	if auth.HasRole(target.Role, roleFromContext(r.Context())) {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(403)
+		w.Write([]byte("Can't moderate a user with the same or a higher role"))
+		return
+	}
+
+	dbUser, err := update(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(404)
+		w.Write(fmt.Appendf([]byte{}, "User with ID %v not found", userID))
+		return
+	}
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed updating user: %v", err))
+		return
+	}
+
+	if _, err := cfg.db.CreateModerationAction(r.Context(), database.CreateModerationActionParams{
+		ModeratorID: uuid.NullUUID{UUID: moderatorID, Valid: true},
+		Action:      action,
+		UserID:      uuid.NullUUID{UUID: userID, Valid: true},
+		Note:        sql.NullString{String: note, Valid: note != ""},
+	}); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed recording the action: %v", err))
+		return
+	}
+
+	user := adminUserStruct{
+		ID:           dbUser.ID,
+		Email:        dbUser.Email,
+		Role:         dbUser.Role,
+		Banned:       dbUser.Banned,
+		FailedLogins: dbUser.FailedLoginAttempts,
+	}
+	if dbUser.SuspendedUntil.Valid {
+		user.SuspendedUntil = &dbUser.SuspendedUntil.Time
+	}
+
+	userJson, err := json.Marshal(user)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed marshalling the response body: %v", err))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(userJson)
+}
+
+// promoteAdmin makes the user with ADMIN_EMAIL an admin, so a fresh
+// deployment has someone who can hand out roles. The address has to be
+// verified, so whoever signs up with it first can't take the role.
+func (cfg *apiConfig) promoteAdmin(ctx context.Context, email string) error {
+	email, err := mail.NormalizeAddress(email)
+	if err != nil {
+		return fmt.Errorf("invalid ADMIN_EMAIL: %v", err)
+	}
+	userDB, err := cfg.db.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Printf("no user with ADMIN_EMAIL %v yet, sign up and restart to make them admin", email)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed getting the admin user: %v", err)
+	}
+	if !userDB.EmailVerifiedAt.Valid {
+		log.Printf("ADMIN_EMAIL %v isn't verified yet, verify it and restart to make them admin", email)
+		return nil
+	}
+	if userDB.Role == auth.RoleAdmin {
+		return nil
+	}
+	if _, err := cfg.db.SetRoleUserWithID(ctx, database.SetRoleUserWithIDParams{
+		ID:   userDB.ID,
+		Role: auth.RoleAdmin,
+	}); err != nil {
+		return fmt.Errorf("failed promoting the admin user: %v", err)
+	}
+	log.Printf("made %v an admin", email)
+	return nil
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/marekmchl/Chirpy/internal/auth"
+	"github.com/marekmchl/Chirpy/internal/database"
+	"github.com/marekmchl/Chirpy/internal/mail"
+)
+
+const emailChangeDuration = time.Duration(24 * time.Hour)
+
+// checkCurrentPassword re-authenticates a logged in user before a sensitive
+// change, so a stolen access token alone can't take over the account. Wrong
+// guesses count towards the login lockout.
+func (cfg *apiConfig) checkCurrentPassword(w http.ResponseWriter, r *http.Request, userDB database.User, password string) bool {
+	userDB, wait, err := claimLoginAttempt(r.Context(), cfg.db, cfg.accountLoginPolicy, userDB)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed counting the login attempt: %v", err))
+		return false
+	}
+	if wait > 0 {
+		respondWithTooManyAttempts(w, wait, "Too many failed logins, try again later")
+		return false
+	}
+	if err := auth.CheckPasswordHash(userDB.HashedPassword, password); err != nil {
+		recordFailedLogin(cfg.accountLoginPolicy, userDB)
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(401)
+		w.Write([]byte("Incorrect current password"))
+		return false
+	}
+	releaseLoginAttempt(r.Context(), cfg.db, userDB)
+	return true
+}
+
+// changePassword checks newPassword against the policy and stores it,
+// logging the user out of every session. It responds itself on failure.
+func (cfg *apiConfig) changePassword(w http.ResponseWriter, r *http.Request, userDB database.User, newPassword string) (database.User, bool) {
+	if !cfg.checkPasswordPolicy(w, newPassword, userDB.Email) {
+		return database.User{}, false
+	}
+	hashedPassword, err := auth.HashPassword(newPassword)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed hashing the password: %v", err))
+		return database.User{}, false
+	}
+	dbUser, err := cfg.db.UpdatePasswordUserWithID(r.Context(), database.UpdatePasswordUserWithIDParams{
+		ID:             userDB.ID,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed updating the password: %v", err))
+		return database.User{}, false
+	}
+	if err := cfg.revokeAllCredentials(r.Context(), userDB.ID); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed signing out everywhere: %v", err))
+		return database.User{}, false
+	}
+	return dbUser, true
+}
+
+// requestEmailChange remembers newEmail as the user's pending address and
+// mails a confirmation link to it. The address only changes once the link
+// is opened. It responds itself on failure.
+func (cfg *apiConfig) requestEmailChange(w http.ResponseWriter, r *http.Request, userDB database.User, newEmail string) bool {
+	email, ok := cfg.checkNewEmail(w, r, newEmail, userDB.ID)
+	if !ok {
+		return false
+	}
+	if email == userDB.Email {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write([]byte("That is already your email address"))
+		return false
+	}
+
+	if err := cfg.db.SetPendingEmailUserWithID(r.Context(), database.SetPendingEmailUserWithIDParams{
+		ID:           userDB.ID,
+		PendingEmail: sql.NullString{String: email, Valid: true},
+	}); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed saving the new email: %v", err))
+		return false
+	}
+	if err := cfg.sendEmailChangeConfirmation(r.Context(), userDB, email); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(502)
+		w.Write(fmt.Appendf([]byte{}, "Failed sending the confirmation email: %v", err))
+		return false
+	}
+	return true
+}
+
+func (cfg *apiConfig) sendEmailChangeConfirmation(ctx context.Context, userDB database.User, newEmail string) error {
+	token, err := auth.MakeEmailChangeToken(userDB.ID, newEmail, cfg.keys, emailChangeDuration)
+	if err != nil {
+		return err
+	}
+	link := cfg.baseURL + "/api/users/email/confirm?token=" + url.QueryEscape(token)
+	if err := cfg.mailer.Send(ctx, mail.Message{
+		To:      newEmail,
+		Subject: "Confirm your new Chirpy email address",
+		Body: fmt.Sprintf("Open this link within %v to use this address for your Chirpy account:\n\n%s\n\n"+
+			"If you didn't ask for this, you can ignore this email.\n", emailChangeDuration, link),
+	}); err != nil {
+		return err
+	}
+
+	// tell the current address too, in case someone else is changing it
+	if err := cfg.mailer.Send(ctx, mail.Message{
+		To:      userDB.Email,
+		Subject: "Your Chirpy email address is being changed",
+		Body: fmt.Sprintf("Someone asked to change the email address of your Chirpy account to %s.\n\n"+
+			"If that wasn't you, reset your password right away.\n", newEmail),
+	}); err != nil {
+		log.Printf("failed notifying user %v of an email change: %v", userDB.ID, err)
+	}
+	return nil
+}
+
+func (cfg *apiConfig) handlerChangePassword(w http.ResponseWriter, r *http.Request) {
+	reqUserID := userIDFromContext(r.Context())
+
+	type parameters struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "Failed decoding parameters: %v", err))
+		return
+	}
+
+	userDB, err := cfg.db.GetUserByID(r.Context(), reqUserID)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed getting the user: %v", err))
+		return
+	}
+	if !cfg.checkCurrentPassword(w, r, userDB, params.CurrentPassword) {
+		return
+	}
+	if _, ok := cfg.changePassword(w, r, userDB, params.NewPassword); !ok {
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+func (cfg *apiConfig) handlerChangeEmail(w http.ResponseWriter, r *http.Request) {
+	reqUserID := userIDFromContext(r.Context())
+
+	type parameters struct {
+		CurrentPassword string `json:"current_password"`
+		NewEmail        string `json:"new_email"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "Failed decoding parameters: %v", err))
+		return
+	}
+
+	userDB, err := cfg.db.GetUserByID(r.Context(), reqUserID)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed getting the user: %v", err))
+		return
+	}
+	if !cfg.checkCurrentPassword(w, r, userDB, params.CurrentPassword) {
+		return
+	}
+	if !cfg.requestEmailChange(w, r, userDB, params.NewEmail) {
+		return
+	}
+
+	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(202)
+	w.Write([]byte("Confirmation sent to the new address"))
+}
+
+// handlerConfirmEmailChange switches to the pending address once its owner
+// opens the link sent to it.
+func (cfg *apiConfig) handlerConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	userID, email, err := auth.ValidateEmailChangeToken(r.URL.Query().Get("token"), cfg.keys)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "Invalid confirmation link: %v", tokenErrorMessage(err)))
+		return
+	}
+
+	// only the most recently requested address can be confirmed, so older
+	// links stop working
+	_, err = cfg.db.ConfirmPendingEmailUserWithID(r.Context(), database.ConfirmPendingEmailUserWithIDParams{
+		ID:           userID,
+		PendingEmail: sql.NullString{String: email, Valid: true},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(409)
+		w.Write([]byte("The link is for an email change that was replaced or already confirmed"))
+		return
+	}
+	if isUniqueViolation(err) {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(409)
+		w.Write([]byte("Email is already in use"))
+		return
+	}
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed changing the email: %v", err))
+		return
+	}
+
+	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(200)
+	w.Write([]byte("Email changed"))
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/marekmchl/Chirpy/internal/auth"
+	"github.com/marekmchl/Chirpy/internal/database"
+	"github.com/marekmchl/Chirpy/internal/export"
+	"github.com/marekmchl/Chirpy/internal/mail"
+)
+
+const (
+	dataExportDuration        = time.Duration(7 * 24 * time.Hour)
+	dataExportCleanupInterval = time.Duration(1 * time.Hour)
+)
+
+type dataExportStruct struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	Status    string     `json:"status"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// handlerRequestDataExport starts building an archive of the user's data in
+// the background. They get an email with a download link once it's ready,
+// and can't request another until that link expires.
+func (cfg *apiConfig) handlerRequestDataExport(w http.ResponseWriter, r *http.Request) {
+	reqUserID := userIDFromContext(r.Context())
+
+	// an export still pending after an hour is given up on, so it doesn't
+	// block new ones
+	if err := cfg.db.FailStaleDataExportsForUser(r.Context(), reqUserID); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed checking for open exports: %v", err))
+		return
+	}
+
+	// every export keeps a whole archive around and sends an email, so
+	// there is at most one per user until its link expires
+	openExport, err := cfg.db.GetOpenDataExportForUser(r.Context(), reqUserID)
+	if err == nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(409)
+		if openExport.Status == "pending" {
+			w.Write([]byte("An export is already being prepared"))
+			return
+		}
+		w.Write(fmt.Appendf([]byte{}, "Your last export can be downloaded until %v, request a new one after that",
+			openExport.ExpiresAt.Time.UTC().Format(time.RFC3339)))
+		return
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed checking for open exports: %v", err))
+		return
+	}
+
+	// the insert checks again, for requests racing this one
+	dbExport, err := cfg.db.CreateDataExport(r.Context(), reqUserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(409)
+		w.Write([]byte("An export is already being prepared"))
+		return
+	}
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed creating the export: %v", err))
+		return
+	}
+	go cfg.buildDataExport(dbExport)
+
+	exportJson, err := json.Marshal(dataExportStruct{
+		ID:        dbExport.ID,
+		CreatedAt: dbExport.CreatedAt,
+		Status:    dbExport.Status,
+	})
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed marshalling the response body: %v", err))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(202)
+	w.Write(exportJson)
+}
+
+func (cfg *apiConfig) handlerGetDataExports(w http.ResponseWriter, r *http.Request) {
+	reqUserID := userIDFromContext(r.Context())
+
+	dbExports, err := cfg.db.GetDataExportsForUser(r.Context(), reqUserID)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed getting exports: %v", err))
+		return
+	}
+
+	exports := []dataExportStruct{}
+	for _, dbExport := range dbExports {
+		dataExport := dataExportStruct{
+			ID:        dbExport.ID,
+			CreatedAt: dbExport.CreatedAt,
+			Status:    dbExport.Status,
+		}
+		if dbExport.ExpiresAt.Valid {
+			dataExport.ExpiresAt = &dbExport.ExpiresAt.Time
+		}
+		exports = append(exports, dataExport)
+	}
+
+	exportsJson, err := json.Marshal(exports)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed marshalling the response body: %v", err))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(exportsJson)
+}
+
+// handlerDownloadDataExport serves a finished archive to whoever holds the
+// signed link from the email, so it also works from a mail client without
+// logging in.
+func (cfg *apiConfig) handlerDownloadDataExport(w http.ResponseWriter, r *http.Request) {
+	exportID, err := uuid.Parse(r.PathValue("exportID"))
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "Failed parsing the ID: %v", err))
+		return
+	}
+	userID, tokenExportID, err := auth.ValidateDownloadToken(r.URL.Query().Get("token"), cfg.keys)
+	if err != nil || tokenExportID != exportID {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(403)
+		w.Write([]byte("Invalid or expired download link"))
+		return
+	}
+
+	dbExport, err := cfg.db.GetDataExportByID(r.Context(), exportID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && dbExport.UserID != userID) {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(404)
+		w.Write([]byte("Export not found"))
+		return
+	}
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed getting the export: %v", err))
+		return
+	}
+	if dbExport.Status != "ready" || !dbExport.ExpiresAt.Valid || dbExport.ExpiresAt.Time.Before(time.Now()) {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(410)
+		w.Write([]byte("The export is no longer available, request a new one"))
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/zip")
+	w.Header().Add("Content-Disposition", fmt.Sprintf(`attachment; filename="chirpy-export-%s.zip"`, dbExport.CreatedAt.Format("2006-01-02")))
+	w.Header().Add("Cache-Control", "no-store")
+	w.WriteHeader(200)
+	w.Write(dbExport.Archive)
+}
+
+// buildDataExport collects the user's data into the export and mails them
+// the download link. It runs outside of the request that started it.
+func (cfg *apiConfig) buildDataExport(dbExport database.DataExport) {
+	ctx := context.Background()
+
+	archive, userDB, err := cfg.collectUserData(ctx, dbExport.UserID)
+	if err == nil {
+		var data []byte
+		data, err = archive.ZIP(dbExport.CreatedAt)
+		if err == nil {
+			err = cfg.db.FinishDataExport(ctx, database.FinishDataExportParams{
+				ID:        dbExport.ID,
+				Archive:   data,
+				ExpiresAt: sql.NullTime{Time: time.Now().Add(dataExportDuration), Valid: true},
+			})
+		}
+	}
+	if err != nil {
+		log.Printf("failed building data export %v: %v", dbExport.ID, err)
+		if err := cfg.db.FailDataExport(ctx, dbExport.ID); err != nil {
+			log.Printf("failed marking data export %v as failed: %v", dbExport.ID, err)
+		}
+		return
+	}
+
+	// without the link the archive is no use, so the user may request
+	// another right away
+	if err := cfg.sendDataExportLink(ctx, userDB, dbExport.ID); err != nil {
+		log.Printf("failed sending the link to data export %v: %v", dbExport.ID, err)
+		if err := cfg.db.FailDataExport(ctx, dbExport.ID); err != nil {
+			log.Printf("failed marking data export %v as failed: %v", dbExport.ID, err)
+		}
+	}
+}
+
+func (cfg *apiConfig) sendDataExportLink(ctx context.Context, userDB database.User, exportID uuid.UUID) error {
+	token, err := auth.MakeDownloadToken(userDB.ID, exportID, cfg.keys, dataExportDuration)
+	if err != nil {
+		return err
+	}
+	link := cfg.baseURL + "/api/exports/" + exportID.String() + "/download?token=" + url.QueryEscape(token)
+	return cfg.mailer.Send(ctx, mail.Message{
+		To:      userDB.Email,
+		Subject: "Your Chirpy data export is ready",
+		Body: fmt.Sprintf("Download a copy of your Chirpy data within %v:\n\n%s\n\n"+
+			"Anyone with this link can download it, so don't share it.\n", dataExportDuration, link),
+	})
+}
+
+// collectUserData gathers everything stored about a user. Secrets such as
+// password hashes, TOTP secrets and token hashes are left out.
+func (cfg *apiConfig) collectUserData(ctx context.Context, userID uuid.UUID) (*export.Archive, database.User, error) {
+	archive := export.NewArchive()
+
+	userDB, err := cfg.db.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, database.User{}, fmt.Errorf("failed getting the user: %v", err)
+	}
+	type profileStruct struct {
+		ID                  uuid.UUID  `json:"id"`
+		CreatedAt           time.Time  `json:"created_at"`
+		UpdatedAt           time.Time  `json:"updated_at"`
+		Email               string     `json:"email"`
+		EmailVerified       bool       `json:"email_verified"`
+		PendingEmail        string     `json:"pending_email,omitempty"`
+		IsChirpyRed         bool       `json:"is_chirpy_red"`
+		Role                string     `json:"role"`
+		TwoFactorEnabled    bool       `json:"two_factor_enabled"`
+		SuspendedUntil      *time.Time `json:"suspended_until,omitempty"`
+		Banned              bool       `json:"banned"`
+		DeletionRequestedAt *time.Time `json:"deletion_requested_at,omitempty"`
+	}
+	profile := profileStruct{
+		ID:               userDB.ID,
+		CreatedAt:        userDB.CreatedAt,
+		UpdatedAt:        userDB.UpdatedAt,
+		Email:            userDB.Email,
+		EmailVerified:    userDB.EmailVerifiedAt.Valid,
+		PendingEmail:     userDB.PendingEmail.String,
+		IsChirpyRed:      userDB.IsChirpyRed,
+		Role:             userDB.Role,
+		TwoFactorEnabled: userDB.TotpEnabled,
+		Banned:           userDB.Banned,
+	}
+	if userDB.SuspendedUntil.Valid {
+		profile.SuspendedUntil = &userDB.SuspendedUntil.Time
+	}
+	if userDB.DeletionRequestedAt.Valid {
+		profile.DeletionRequestedAt = &userDB.DeletionRequestedAt.Time
+	}
+	archive.Add("profile.json", profile)
+
+	dbSubscription, err := cfg.db.GetSubscriptionForUser(ctx, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, database.User{}, fmt.Errorf("failed getting the subscription: %v", err)
+	}
+	if err == nil {
+		type subscriptionStruct struct {
+			Status           string     `json:"status"`
+			StartedAt        time.Time  `json:"started_at"`
+			CurrentPeriodEnd time.Time  `json:"current_period_end"`
+			CancelledAt      *time.Time `json:"cancelled_at,omitempty"`
+		}
+		subscription := subscriptionStruct{
+			Status:           dbSubscription.Status,
+			StartedAt:        dbSubscription.StartedAt,
+			CurrentPeriodEnd: dbSubscription.CurrentPeriodEnd,
+		}
+		if dbSubscription.CancelledAt.Valid {
+			subscription.CancelledAt = &dbSubscription.CancelledAt.Time
+		}
+		archive.Add("subscription.json", subscription)
+	}
+
+	dbChirps, err := cfg.db.GetChirpsByUser(ctx, userID)
+	if err != nil {
+		return nil, database.User{}, fmt.Errorf("failed getting chirps: %v", err)
+	}
+	type chirpStruct struct {
+		ID        uuid.UUID `json:"id"`
+		CreatedAt time.Time `json:"created_at"`
+		UpdatedAt time.Time `json:"updated_at"`
+		Body      string    `json:"body"`
+		Flagged   bool      `json:"flagged"`
+		Hidden    bool      `json:"hidden"`
+	}
+	chirps := []chirpStruct{}
+	for _, dbChirp := range dbChirps {
+		chirps = append(chirps, chirpStruct{
+			ID:        dbChirp.ID,
+			CreatedAt: dbChirp.CreatedAt,
+			UpdatedAt: dbChirp.UpdatedAt,
+			Body:      dbChirp.Body,
+			Flagged:   dbChirp.Flagged,
+			Hidden:    dbChirp.Hidden,
+		})
+	}
+	archive.Add("chirps.json", chirps)
+
+	dbTokens, err := cfg.db.GetRefreshTokensForUser(ctx, userID)
+	if err != nil {
+		return nil, database.User{}, fmt.Errorf("failed getting sessions: %v", err)
+	}
+	type sessionStruct struct {
+		ID         uuid.UUID  `json:"id"`
+		CreatedAt  time.Time  `json:"created_at"`
+		UserAgent  string     `json:"user_agent"`
+		IpAddress  string     `json:"ip_address"`
+		LastUsedAt time.Time  `json:"last_used_at"`
+		ExpiresAt  time.Time  `json:"expires_at"`
+		RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+		ClientID   *uuid.UUID `json:"client_id,omitempty"`
+	}
+	sessions := []sessionStruct{}
+	for _, dbToken := range dbTokens {
+		session := sessionStruct{
+			ID:         dbToken.FamilyID,
+			CreatedAt:  dbToken.CreatedAt,
+			UserAgent:  dbToken.UserAgent,
+			IpAddress:  dbToken.IpAddress,
+			LastUsedAt: dbToken.LastUsedAt,
+			ExpiresAt:  dbToken.ExpiresAt,
+		}
+		if dbToken.RevokedAt.Valid {
+			session.RevokedAt = &dbToken.RevokedAt.Time
+		}
+		if dbToken.ClientID.Valid {
+			session.ClientID = &dbToken.ClientID.UUID
+		}
+		sessions = append(sessions, session)
+	}
+	archive.Add("sessions.json", sessions)
+
+	dbPersonalTokens, err := cfg.db.GetActivePersonalAccessTokensForUser(ctx, userID)
+	if err != nil {
+		return nil, database.User{}, fmt.Errorf("failed getting personal access tokens: %v", err)
+	}
+	personalTokens := []personalAccessTokenStruct{}
+	for _, dbToken := range dbPersonalTokens {
+		personalTokens = append(personalTokens, toPersonalAccessTokenStruct(dbToken))
+	}
+	archive.Add("personal_access_tokens.json", personalTokens)
+
+	dbClients, err := cfg.db.GetOAuthClientsForOwner(ctx, userID)
+	if err != nil {
+		return nil, database.User{}, fmt.Errorf("failed getting OAuth clients: %v", err)
+	}
+	clients := []oauthClientStruct{}
+	for _, dbClient := range dbClients {
+		clients = append(clients, toOAuthClientStruct(dbClient))
+	}
+	archive.Add("oauth_clients.json", clients)
+
+	dbReports, err := cfg.db.GetReportsByReporter(ctx, userID)
+	if err != nil {
+		return nil, database.User{}, fmt.Errorf("failed getting reports: %v", err)
+	}
+	reports := []reportStruct{}
+	for _, dbReport := range dbReports {
+		reports = append(reports, toReportStruct(dbReport))
+	}
+	archive.Add("reports.json", reports)
+
+	return archive, userDB, nil
+}
+
+// deleteDataExportsPeriodically drops archives after their links expire, and
+// exports that never finished.
+func (cfg *apiConfig) deleteDataExportsPeriodically() {
+	ticker := time.NewTicker(dataExportCleanupInterval)
+	go func() {
+		for {
+			deleted, err := cfg.db.DeleteExpiredDataExports(context.Background())
+			if err != nil {
+				log.Printf("failed deleting data exports: %v", err)
+			} else if deleted > 0 {
+				log.Printf("deleted %d expired data exports", deleted)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/marekmchl/Chirpy/internal/auth"
+	"github.com/marekmchl/Chirpy/internal/database"
+	"github.com/marekmchl/Chirpy/internal/mail"
+)
+
+const emailVerificationDuration = time.Duration(24 * time.Hour)
+
+// isUniqueViolation reports whether err is Postgres refusing a duplicate
+// value for a unique column.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// checkNewEmail validates an address the user with userID wants to use and
+// returns it normalized, or responds with 400 or 409 if it is invalid or
+// taken by another account. Pass uuid.Nil for a new account.
+func (cfg *apiConfig) checkNewEmail(w http.ResponseWriter, r *http.Request, email string, userID uuid.UUID) (string, bool) {
+	normalized, err := mail.NormalizeAddress(email)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "%v", err))
+		return "", false
+	}
+	existing, err := cfg.db.GetUserByEmail(r.Context(), normalized)
+	if err == nil && existing.ID != userID {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(409)
+		w.Write([]byte("Email is already in use"))
+		return "", false
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed checking the email: %v", err))
+		return "", false
+	}
+	return normalized, true
+}
+
+// sendVerificationEmail mails the user a link proving they own their
+// current address.
+func (cfg *apiConfig) sendVerificationEmail(ctx context.Context, userDB database.User) error {
+	token, err := auth.MakeEmailVerificationToken(userDB.ID, userDB.Email, cfg.keys, emailVerificationDuration)
+	if err != nil {
+		return err
+	}
+	link := cfg.baseURL + "/api/users/verify?token=" + url.QueryEscape(token)
+	return cfg.mailer.Send(ctx, mail.Message{
+		To:      userDB.Email,
+		Subject: "Verify your Chirpy email address",
+		Body: fmt.Sprintf("Open this link within %v to verify your email address:\n\n%s\n\n"+
+			"If you didn't sign up for Chirpy, you can ignore this email.\n", emailVerificationDuration, link),
+	})
+}
+
+func (cfg *apiConfig) handlerVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	userID, email, err := auth.ValidateEmailVerificationToken(r.URL.Query().Get("token"), cfg.keys)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "Invalid verification link: %v", tokenErrorMessage(err)))
+		return
+	}
+
+	// the update only matches while the account still uses the address the
+	// link was sent to
+	if _, err := cfg.db.SetEmailVerifiedUserWithID(r.Context(), database.SetEmailVerifiedUserWithIDParams{
+		ID:    userID,
+		Email: email,
+	}); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(409)
+			w.Write([]byte("The link is for an email address the account no longer uses"))
+			return
+		}
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed verifying the email: %v", err))
+		return
+	}
+
+	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(200)
+	w.Write([]byte("Email verified"))
+}
+
+func (cfg *apiConfig) handlerResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	reqUserID := userIDFromContext(r.Context())
+
+	userDB, err := cfg.db.GetUserByID(r.Context(), reqUserID)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed getting the user: %v", err))
+		return
+	}
+	if userDB.EmailVerifiedAt.Valid {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(409)
+		w.Write([]byte("Email is already verified"))
+		return
+	}
+
+	if err := cfg.sendVerificationEmail(r.Context(), userDB); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(502)
+		w.Write(fmt.Appendf([]byte{}, "Failed sending the verification email: %v", err))
+		return
+	}
+
+	w.WriteHeader(204)
+}
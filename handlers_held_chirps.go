@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/marekmchl/Chirpy/internal/database"
+)
+
+type heldChirpStruct struct {
+	ID         uuid.UUID `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	Body       string    `json:"body"`
+	UserID     uuid.UUID `json:"user_id"`
+	HeldBy     []string  `json:"held_by"`
+	HoldReason string    `json:"hold_reason"`
+}
+
+func toHeldChirpStruct(dbChirp database.Chirp) heldChirpStruct {
+	heldBy := []string{}
+	if dbChirp.HeldBy.String != "" {
+		heldBy = strings.Split(dbChirp.HeldBy.String, ",")
+	}
+	return heldChirpStruct{
+		ID:         dbChirp.ID,
+		CreatedAt:  dbChirp.CreatedAt,
+		Body:       dbChirp.Body,
+		UserID:     dbChirp.UserID,
+		HeldBy:     heldBy,
+		HoldReason: dbChirp.HoldReason.String,
+	}
+}
+
+// handlerGetHeldChirps lists the chirps moderation held back, oldest first,
+// for moderators to approve or reject.
+func (cfg *apiConfig) handlerGetHeldChirps(w http.ResponseWriter, r *http.Request) {
+	dbChirps, err := cfg.db.GetHeldChirps(r.Context())
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed getting held chirps: %v", err))
+		return
+	}
+
+	chirps := []heldChirpStruct{}
+	for _, dbChirp := range dbChirps {
+		chirps = append(chirps, toHeldChirpStruct(dbChirp))
+	}
+
+	chirpsJson, err := json.Marshal(chirps)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed marshalling the response body: %v", err))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(chirpsJson)
+}
+
+// handlerApproveHeldChirp publishes a held chirp.
+func (cfg *apiConfig) handlerApproveHeldChirp(w http.ResponseWriter, r *http.Request) {
+	cfg.reviewHeldChirp(w, r, "approve_chirp", func(ctx context.Context, db *database.Queries, chirpID uuid.UUID) (database.Chirp, error) {
+		return db.ApproveHeldChirp(ctx, chirpID)
+	})
+}
+
+// handlerRejectHeldChirp hides a held chirp for good.
+func (cfg *apiConfig) handlerRejectHeldChirp(w http.ResponseWriter, r *http.Request) {
+	cfg.reviewHeldChirp(w, r, "reject_chirp", func(ctx context.Context, db *database.Queries, chirpID uuid.UUID) (database.Chirp, error) {
+		return db.RejectHeldChirp(ctx, chirpID)
+	})
+}
+
+// reviewHeldChirp applies review to the held chirp named by the path and
+// records it as a moderation action, with the optional note from the body.
+func (cfg *apiConfig) reviewHeldChirp(w http.ResponseWriter, r *http.Request, action string, review func(context.Context, *database.Queries, uuid.UUID) (database.Chirp, error)) {
+	moderatorID := userIDFromContext(r.Context())
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "Failed parsing the ID: %v", err))
+		return
+	}
+
+	type requestBody struct {
+		Note string `json:"note"`
+	}
+
+	reqData := requestBody{}
+	if r.ContentLength != 0 {
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&reqData); err != nil {
+			w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(400)
+			w.Write(fmt.Appendf([]byte{}, "Failed decoding data: %v", err))
+			return
+		}
+	}
+
+	tx, err := cfg.sqlDB.BeginTx(r.Context(), nil)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed starting a transaction: %v", err))
+		return
+	}
+	defer tx.Rollback()
+	db := cfg.db.WithTx(tx)
+
+	dbChirp, err := review(r.Context(), db, chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(404)
+		w.Write(fmt.Appendf([]byte{}, "Held chirp with ID %v not found", chirpID))
+		return
+	}
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed reviewing the chirp: %v", err))
+		return
+	}
+	if _, err := db.CreateModerationAction(r.Context(), database.CreateModerationActionParams{
+		ModeratorID: uuid.NullUUID{UUID: moderatorID, Valid: true},
+		Action:      action,
+		ChirpID:     uuid.NullUUID{UUID: dbChirp.ID, Valid: true},
+		UserID:      uuid.NullUUID{UUID: dbChirp.UserID, Valid: true},
+		Note:        sql.NullString{String: reqData.Note, Valid: reqData.Note != ""},
+	}); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed recording the action: %v", err))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed reviewing the chirp: %v", err))
+		return
+	}
+
+	chirpJson, err := json.Marshal(toHeldChirpStruct(dbChirp))
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed marshalling the response body: %v", err))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(chirpJson)
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// handlerGetJWKS publishes the public signing keys so other services can
+// verify access tokens without sharing a secret.
+func (cfg *apiConfig) handlerGetJWKS(w http.ResponseWriter, r *http.Request) {
+	jwksJson, err := json.Marshal(cfg.keys.JWKS())
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed marshalling the response body: %v", err))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Add("Cache-Control", "public, max-age=300")
+	w.WriteHeader(200)
+	w.Write(jwksJson)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/marekmchl/Chirpy/internal/database"
+	"github.com/marekmchl/Chirpy/internal/throttle"
+)
+
+// defaultAccountLoginPolicy slows down guessing the password of one account,
+// defaultIPLoginPolicy guessing from one address across many accounts.
+var (
+	defaultAccountLoginPolicy = throttle.Policy{
+		FreeAttempts:    3,
+		BaseDelay:       time.Duration(1 * time.Second),
+		MaxDelay:        time.Duration(1 * time.Minute),
+		LockoutAfter:    10,
+		LockoutDuration: time.Duration(15 * time.Minute),
+		ResetAfter:      time.Duration(1 * time.Hour),
+	}
+	defaultIPLoginPolicy = throttle.Policy{
+		FreeAttempts:    10,
+		BaseDelay:       time.Duration(1 * time.Second),
+		MaxDelay:        time.Duration(1 * time.Minute),
+		LockoutAfter:    50,
+		LockoutDuration: time.Duration(1 * time.Hour),
+		ResetAfter:      time.Duration(1 * time.Hour),
+	}
+)
+
+// claimLoginAttempt counts an attempt to log in as the user before the
+// credentials are checked, so concurrent guesses can't all get in before
+// the first failure is recorded. It refuses the attempt with how long to
+// wait while the account is backing off or locked out. The returned user
+// is the updated row. A right guess is taken back with resetFailedLogins
+// or releaseLoginAttempt.
+func claimLoginAttempt(ctx context.Context, db *database.Queries, policy throttle.Policy, userDB database.User) (database.User, time.Duration, error) {
+	now := time.Now()
+	failures := int(userDB.FailedLoginAttempts)
+	if failures > 0 && policy.Expired(userDB.LastFailedLoginAt.Time, now) {
+		// only forgets them if no other attempt came in meanwhile
+		if err := db.ForgetExpiredFailedLoginsUserWithID(ctx, database.ForgetExpiredFailedLoginsUserWithIDParams{
+			ID:                userDB.ID,
+			LastFailedLoginAt: sql.NullTime{Time: now.Add(-policy.ResetAfter), Valid: true},
+		}); err != nil {
+			return database.User{}, 0, err
+		}
+		failures = 0
+	}
+
+	dbUser, err := db.ClaimLoginAttemptUserWithID(ctx, database.ClaimLoginAttemptUserWithIDParams{
+		ID:                userDB.ID,
+		LoginBlockedUntil: sql.NullTime{Time: now.Add(policy.Delay(failures + 1)), Valid: true},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		dbUser, err := db.GetUserByID(ctx, userDB.ID)
+		if err != nil {
+			return database.User{}, 0, err
+		}
+		return dbUser, max(dbUser.LoginBlockedUntil.Time.Sub(now), time.Second), nil
+	}
+	if err != nil {
+		return database.User{}, 0, err
+	}
+	// other attempts got in since userDB was read, so this one is further
+	// along the backoff than assumed
+	if n := int(dbUser.FailedLoginAttempts); n != failures+1 {
+		blockedUntil := sql.NullTime{Time: now.Add(policy.Delay(n)), Valid: true}
+		if err := db.ExtendLoginBlockUserWithID(ctx, database.ExtendLoginBlockUserWithIDParams{
+			ID:                userDB.ID,
+			LoginBlockedUntil: blockedUntil,
+		}); err != nil {
+			return database.User{}, 0, err
+		}
+	}
+	return dbUser, 0, nil
+}
+
+// recordFailedLogin notes a wrong guess, already counted by
+// claimLoginAttempt, logging when it locks the account out.
+func recordFailedLogin(policy throttle.Policy, userDB database.User) {
+	failures := int(userDB.FailedLoginAttempts)
+	if policy.Locked(failures) && !policy.Locked(failures-1) {
+		log.Printf("security: locked out user %v after %d failed logins", userDB.ID, failures)
+	}
+}
+
+// releaseLoginAttempt takes back an attempt that was right without
+// forgetting the failures before it, for checks that don't complete a
+// login.
+func releaseLoginAttempt(ctx context.Context, db *database.Queries, userDB database.User) {
+	if err := db.ReleaseLoginAttemptUserWithID(ctx, userDB.ID); err != nil {
+		log.Printf("failed releasing a login attempt of user %v: %v", userDB.ID, err)
+	}
+}
+
+// resetFailedLogins forgets the failed attempts of a user who just logged
+// in.
+func resetFailedLogins(ctx context.Context, db *database.Queries, userDB database.User) {
+	if _, err := db.ResetFailedLoginsUserWithID(ctx, userDB.ID); err != nil {
+		log.Printf("failed resetting failed logins of user %v: %v", userDB.ID, err)
+	}
+}
+
+func respondWithTooManyAttempts(w http.ResponseWriter, wait time.Duration, message string) {
+	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Add("Retry-After", fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+	w.WriteHeader(429)
+	w.Write([]byte(message))
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/marekmchl/Chirpy/internal/database"
+	"github.com/marekmchl/Chirpy/internal/profanity"
+)
+
+type moderationWordStruct struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Word      string    `json:"word"`
+	Action    string    `json:"action"`
+	Language  string    `json:"language,omitempty"`
+}
+
+func toModerationWordStruct(dbWord database.ModerationWord) moderationWordStruct {
+	return moderationWordStruct{
+		ID:        dbWord.ID,
+		CreatedAt: dbWord.CreatedAt,
+		UpdatedAt: dbWord.UpdatedAt,
+		Word:      dbWord.Word,
+		Action:    dbWord.Action,
+		Language:  dbWord.Language.String,
+	}
+}
+
+func (cfg *apiConfig) handlerGetModerationWords(w http.ResponseWriter, r *http.Request) {
+	dbWords, err := cfg.db.GetAllModerationWords(r.Context())
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed getting the word list: %v", err))
+		return
+	}
+
+	words := []moderationWordStruct{}
+	for _, dbWord := range dbWords {
+		words = append(words, toModerationWordStruct(dbWord))
+	}
+
+	wordsJson, err := json.Marshal(words)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed marshalling the response body: %v", err))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(wordsJson)
+}
+
+func (cfg *apiConfig) handlerAddModerationWord(w http.ResponseWriter, r *http.Request) {
+	type requestBody struct {
+		Word     string `json:"word"`
+		Action   string `json:"action"`
+		Language string `json:"language"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	reqData := requestBody{}
+	if err := decoder.Decode(&reqData); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "Failed decoding data: %v", err))
+		return
+	}
+
+	params, err := moderationWordParams(reqData.Word, reqData.Action, reqData.Language)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "Invalid word: %v", err))
+		return
+	}
+
+	dbWord, err := cfg.db.UpsertModerationWord(r.Context(), params)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed saving the word: %v", err))
+		return
+	}
+
+	if err := cfg.loadProfanityWords(r.Context()); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed reloading the word list: %v", err))
+		return
+	}
+
+	wordJson, err := json.Marshal(toModerationWordStruct(dbWord))
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed marshalling the response body: %v", err))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(201)
+	w.Write(wordJson)
+}
+
+func (cfg *apiConfig) handlerDeleteModerationWord(w http.ResponseWriter, r *http.Request) {
+	wordID, err := uuid.Parse(r.PathValue("wordID"))
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "Failed parsing the ID: %v", err))
+		return
+	}
+
+	if _, err := cfg.db.DeleteModerationWordByID(r.Context(), wordID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(404)
+			w.Write(fmt.Appendf([]byte{}, "Word with ID %v not found", wordID))
+			return
+		}
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed deleting the word: %v", err))
+		return
+	}
+
+	if err := cfg.loadProfanityWords(r.Context()); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed reloading the word list: %v", err))
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// handlerImportModerationWords takes a CSV body with "word,action,language"
+// rows. Action and language are optional and a leading header row is
+// skipped. Every row is validated before anything is written, and the rows
+// are saved in one transaction.
+func (cfg *apiConfig) handlerImportModerationWords(w http.ResponseWriter, r *http.Request) {
+	reader := csv.NewReader(r.Body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	paramsList := []database.UpsertModerationWordParams{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(400)
+			w.Write(fmt.Appendf([]byte{}, "Failed reading CSV: %v", err))
+			return
+		}
+		if line == 1 && strings.EqualFold(strings.TrimSpace(record[0]), "word") {
+			continue
+		}
+		if len(record) > 3 {
+			w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(400)
+			w.Write(fmt.Appendf([]byte{}, "Line %d: expected at most 3 fields, got %d", line, len(record)))
+			return
+		}
+		for len(record) < 3 {
+			record = append(record, "")
+		}
+
+		params, err := moderationWordParams(record[0], record[1], record[2])
+		if err != nil {
+			w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(400)
+			w.Write(fmt.Appendf([]byte{}, "Line %d: %v", line, err))
+			return
+		}
+		paramsList = append(paramsList, params)
+	}
+
+	// all or nothing, so a failed import doesn't leave half the list behind
+	tx, err := cfg.sqlDB.BeginTx(r.Context(), nil)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed starting a transaction: %v", err))
+		return
+	}
+	defer tx.Rollback()
+	db := cfg.db.WithTx(tx)
+
+	for _, params := range paramsList {
+		if _, err := db.UpsertModerationWord(r.Context(), params); err != nil {
+			w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(500)
+			w.Write(fmt.Appendf([]byte{}, "Failed saving word '%v': %v", params.Word, err))
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed saving the words: %v", err))
+		return
+	}
+
+	if err := cfg.loadProfanityWords(r.Context()); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed reloading the word list: %v", err))
+		return
+	}
+
+	type responseBody struct {
+		Imported int `json:"imported"`
+	}
+	resJson, err := json.Marshal(responseBody{Imported: len(paramsList)})
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed marshalling the response body: %v", err))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(resJson)
+}
+
+func moderationWordParams(word, action, language string) (database.UpsertModerationWordParams, error) {
+	word = strings.ToLower(strings.TrimSpace(word))
+	action = strings.ToLower(strings.TrimSpace(action))
+	language = strings.ToLower(strings.TrimSpace(language))
+
+	if word == "" || strings.ContainsFunc(word, unicode.IsSpace) {
+		return database.UpsertModerationWordParams{}, fmt.Errorf("word must be a single non-empty word")
+	}
+	if action == "" {
+		action = profanity.ActionMask
+	}
+	if !profanity.IsValidAction(action) {
+		return database.UpsertModerationWordParams{}, fmt.Errorf("'%v' is not one of mask, reject, flag", action)
+	}
+
+	return database.UpsertModerationWordParams{
+		Word:     word,
+		Action:   action,
+		Language: sql.NullString{String: language, Valid: language != ""},
+	}, nil
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/marekmchl/Chirpy/internal/auth"
+	"github.com/marekmchl/Chirpy/internal/database"
+	"github.com/marekmchl/Chirpy/internal/oauth"
+	"github.com/marekmchl/Chirpy/internal/throttle"
+)
+
+// oauthStore keeps the OAuth server's state in Postgres. Client refresh
+// tokens live in refresh_tokens next to the login sessions.
+type oauthStore struct {
+	db          *database.Queries
+	loginPolicy throttle.Policy
+	ipThrottle  *throttle.Tracker
+}
+
+func toOAuthClient(dbClient database.OauthClient) oauth.Client {
+	return oauth.Client{
+		ID:           dbClient.ID,
+		Name:         dbClient.Name,
+		SecretHash:   dbClient.SecretHash.String,
+		RedirectURIs: strings.Fields(dbClient.RedirectUris),
+		Scopes:       auth.SplitScopes(dbClient.Scopes),
+	}
+}
+
+func (s oauthStore) GetClient(ctx context.Context, clientID uuid.UUID) (oauth.Client, error) {
+	dbClient, err := s.db.GetOAuthClientByID(ctx, clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return oauth.Client{}, oauth.ErrNotFound
+	}
+	if err != nil {
+		return oauth.Client{}, err
+	}
+	return toOAuthClient(dbClient), nil
+}
+
+func (s oauthStore) AuthenticateUser(ctx context.Context, ip, email, password, code string) (uuid.UUID, error) {
+	now := time.Now()
+	if wait, ok := s.ipThrottle.Allow(ip, now); !ok {
+		return uuid.Nil, fmt.Errorf("%w: too many failed logins, try again in %v", oauth.ErrAccountRestricted, wait.Round(time.Second))
+	}
+	dbUser, err := s.db.GetUserByEmail(ctx, strings.ToLower(strings.TrimSpace(email)))
+	if errors.Is(err, sql.ErrNoRows) {
+		s.ipThrottle.Failure(ip, now)
+		return uuid.Nil, oauth.ErrInvalidLogin
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+	// one attempt covers both factors, claimed before either is checked
+	dbUser, wait, err := claimLoginAttempt(ctx, s.db, s.loginPolicy, dbUser)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if wait > 0 {
+		return uuid.Nil, fmt.Errorf("%w: too many failed logins, try again in %v", oauth.ErrAccountRestricted, wait.Round(time.Second))
+	}
+	if err := auth.CheckPasswordHash(dbUser.HashedPassword, password); err != nil {
+		s.ipThrottle.Failure(ip, now)
+		recordFailedLogin(s.loginPolicy, dbUser)
+		return uuid.Nil, oauth.ErrInvalidLogin
+	}
+	rehashPasswordIfNeeded(ctx, s.db, dbUser, password)
+	if restriction := accountRestriction(dbUser.Banned, dbUser.SuspendedUntil); restriction != "" {
+		return uuid.Nil, fmt.Errorf("%w: %v", oauth.ErrAccountRestricted, restriction)
+	}
+	if dbUser.TotpEnabled {
+		ok, err := checkSecondFactor(ctx, s.db, dbUser, code, "")
+		if err != nil {
+			return uuid.Nil, err
+		}
+		if !ok {
+			// the consent form takes both factors at once, so a wrong code
+			// counts like a wrong password
+			s.ipThrottle.Failure(ip, now)
+			recordFailedLogin(s.loginPolicy, dbUser)
+			return uuid.Nil, oauth.ErrInvalidLogin
+		}
+	}
+	resetFailedLogins(ctx, s.db, dbUser)
+	cancelAccountDeletion(ctx, s.db, dbUser)
+	return dbUser.ID, nil
+}
+
+func (s oauthStore) CheckUser(ctx context.Context, userID uuid.UUID) error {
+	dbUser, err := s.db.GetUserByID(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: user not found", oauth.ErrAccountRestricted)
+	}
+	if err != nil {
+		return err
+	}
+	if restriction := accountRestriction(dbUser.Banned, dbUser.SuspendedUntil); restriction != "" {
+		return fmt.Errorf("%w: %v", oauth.ErrAccountRestricted, restriction)
+	}
+	return nil
+}
+
+func (s oauthStore) CreateAuthorizationCode(ctx context.Context, code oauth.AuthorizationCode) error {
+	return s.db.CreateOAuthAuthorizationCode(ctx, database.CreateOAuthAuthorizationCodeParams{
+		CodeHash:      code.CodeHash,
+		ClientID:      code.ClientID,
+		UserID:        code.UserID,
+		RedirectUri:   code.RedirectURI,
+		Scopes:        auth.FormatScopes(code.Scopes),
+		CodeChallenge: code.CodeChallenge,
+		ExpiresAt:     code.ExpiresAt,
+	})
+}
+
+func (s oauthStore) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (oauth.AuthorizationCode, error) {
+	dbCode, err := s.db.ConsumeOAuthAuthorizationCode(ctx, codeHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return oauth.AuthorizationCode{}, oauth.ErrNotFound
+	}
+	if err != nil {
+		return oauth.AuthorizationCode{}, err
+	}
+	return oauth.AuthorizationCode{
+		CodeHash:      dbCode.CodeHash,
+		ClientID:      dbCode.ClientID,
+		UserID:        dbCode.UserID,
+		RedirectURI:   dbCode.RedirectUri,
+		Scopes:        auth.SplitScopes(dbCode.Scopes),
+		CodeChallenge: dbCode.CodeChallenge,
+		ExpiresAt:     dbCode.ExpiresAt,
+	}, nil
+}
+
+func (s oauthStore) CreateRefreshToken(ctx context.Context, token oauth.RefreshToken) error {
+	_, err := s.db.CreateClientRefreshToken(ctx, database.CreateClientRefreshTokenParams{
+		TokenHash:   token.TokenHash,
+		TokenPrefix: token.TokenPrefix,
+		UserID:      token.UserID,
+		ExpiresAt:   token.ExpiresAt,
+		FamilyID:    token.FamilyID,
+		ClientID:    uuid.NullUUID{UUID: token.ClientID, Valid: true},
+		Scopes:      sql.NullString{String: auth.FormatScopes(token.Scopes), Valid: true},
+	})
+	return err
+}
+
+func (s oauthStore) GetRefreshToken(ctx context.Context, token string) (oauth.RefreshToken, error) {
+	candidates, err := s.db.GetRefreshTokensByPrefix(ctx, auth.RefreshTokenPrefix(token))
+	if err != nil {
+		return oauth.RefreshToken{}, err
+	}
+	for _, candidate := range candidates {
+		if !auth.CheckRefreshTokenHash(candidate.TokenHash, token) || !candidate.ClientID.Valid {
+			continue
+		}
+		return oauth.RefreshToken{
+			TokenHash:   candidate.TokenHash,
+			TokenPrefix: candidate.TokenPrefix,
+			FamilyID:    candidate.FamilyID,
+			UserID:      candidate.UserID,
+			ClientID:    candidate.ClientID.UUID,
+			Scopes:      auth.SplitScopes(candidate.Scopes.String),
+			IssuedAt:    candidate.CreatedAt,
+			ExpiresAt:   candidate.ExpiresAt,
+			Revoked:     candidate.RevokedAt.Valid,
+			Replaced:    candidate.ReplacedBy.Valid,
+		}, nil
+	}
+	return oauth.RefreshToken{}, oauth.ErrNotFound
+}
+
+func (s oauthStore) RotateRefreshToken(ctx context.Context, tokenHash, replacedBy string) error {
+	_, err := s.db.RotateRefreshToken(ctx, database.RotateRefreshTokenParams{
+		TokenHash:  tokenHash,
+		ReplacedBy: sql.NullString{String: replacedBy, Valid: true},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return oauth.ErrRefreshTokenUsed
+	}
+	return err
+}
+
+func (s oauthStore) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	return s.db.RevokeRefreshTokenFamily(ctx, familyID)
+}
+
+// validRedirectURI accepts absolute https URIs without a fragment, and http
+// ones on the loopback interface for native apps.
+func validRedirectURI(redirectURI string) bool {
+	u, err := url.Parse(redirectURI)
+	if err != nil || u.Host == "" || u.Fragment != "" {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := u.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	default:
+		return false
+	}
+}
+
+type oauthClientStruct struct {
+	ID           uuid.UUID `json:"client_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	Confidential bool      `json:"confidential"`
+	Secret       string    `json:"client_secret,omitempty"`
+}
+
+func toOAuthClientStruct(dbClient database.OauthClient) oauthClientStruct {
+	return oauthClientStruct{
+		ID:           dbClient.ID,
+		CreatedAt:    dbClient.CreatedAt,
+		Name:         dbClient.Name,
+		RedirectURIs: strings.Fields(dbClient.RedirectUris),
+		Scopes:       auth.SplitScopes(dbClient.Scopes),
+		Confidential: dbClient.SecretHash.Valid,
+	}
+}
+
+func (cfg *apiConfig) handlerCreateOAuthClient(w http.ResponseWriter, r *http.Request) {
+	reqUserID := userIDFromContext(r.Context())
+
+	type parameters struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Scopes       []string `json:"scopes"`
+		Confidential bool     `json:"confidential"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "Failed decoding parameters: %v", err))
+		return
+	}
+	if params.Name == "" {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write([]byte("Client name is required"))
+		return
+	}
+	if len(params.RedirectURIs) == 0 {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write([]byte("At least one redirect URI is required"))
+		return
+	}
+	for _, redirectURI := range params.RedirectURIs {
+		if !validRedirectURI(redirectURI) {
+			w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(400)
+			w.Write(fmt.Appendf([]byte{}, "Invalid redirect URI: %v", redirectURI))
+			return
+		}
+	}
+	scopes, err := auth.ParseScopes(params.Scopes)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "Invalid scopes: %v", err))
+		return
+	}
+
+	secret := ""
+	secretHash := sql.NullString{}
+	if params.Confidential {
+		secret, err = oauth.MakeClientSecret()
+		if err != nil {
+			w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(500)
+			w.Write(fmt.Appendf([]byte{}, "Failed making the client secret: %v", err))
+			return
+		}
+		secretHash = sql.NullString{String: oauth.HashSecret(secret), Valid: true}
+	}
+
+	dbClient, err := cfg.db.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+		OwnerID:      reqUserID,
+		Name:         params.Name,
+		SecretHash:   secretHash,
+		RedirectUris: strings.Join(params.RedirectURIs, " "),
+		Scopes:       auth.FormatScopes(scopes),
+	})
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed saving the client: %v", err))
+		return
+	}
+
+	// The secret itself is only ever shown in this response.
+	respClient := toOAuthClientStruct(dbClient)
+	respClient.Secret = secret
+	clientJson, err := json.Marshal(respClient)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed marshalling the response body: %v", err))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(201)
+	w.Write(clientJson)
+}
+
+func (cfg *apiConfig) handlerGetOAuthClients(w http.ResponseWriter, r *http.Request) {
+	reqUserID := userIDFromContext(r.Context())
+
+	dbClients, err := cfg.db.GetOAuthClientsForOwner(r.Context(), reqUserID)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed getting clients: %v", err))
+		return
+	}
+
+	clients := []oauthClientStruct{}
+	for _, dbClient := range dbClients {
+		clients = append(clients, toOAuthClientStruct(dbClient))
+	}
+
+	clientsJson, err := json.Marshal(clients)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed marshalling the response body: %v", err))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(clientsJson)
+}
+
+// handlerDeleteOAuthClient removes a client along with its codes and
+// refresh tokens. Access tokens already issued to it run out on their own.
+func (cfg *apiConfig) handlerDeleteOAuthClient(w http.ResponseWriter, r *http.Request) {
+	reqUserID := userIDFromContext(r.Context())
+
+	clientID, err := uuid.Parse(r.PathValue("clientID"))
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "Failed parsing the ID: %v", err))
+		return
+	}
+
+	deleted, err := cfg.db.DeleteOAuthClientForOwner(r.Context(), database.DeleteOAuthClientForOwnerParams{
+		ID:      clientID,
+		OwnerID: reqUserID,
+	})
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed deleting the client: %v", err))
+		return
+	}
+	if deleted == 0 {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(404)
+		w.Write(fmt.Appendf([]byte{}, "Client with ID %v not found", clientID))
+		return
+	}
+
+	w.WriteHeader(204)
+}
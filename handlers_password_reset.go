@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/marekmchl/Chirpy/internal/auth"
+	"github.com/marekmchl/Chirpy/internal/database"
+	"github.com/marekmchl/Chirpy/internal/mail"
+	"github.com/marekmchl/Chirpy/internal/throttle"
+)
+
+const passwordResetDuration = time.Duration(1 * time.Hour)
+
+// defaultPasswordResetPolicy limits how many reset emails one address
+// receives, so the endpoint can't be used to flood an inbox.
+var defaultPasswordResetPolicy = throttle.Policy{
+	FreeAttempts: 3,
+	BaseDelay:    time.Duration(1 * time.Minute),
+	MaxDelay:     time.Duration(1 * time.Hour),
+	ResetAfter:   time.Duration(24 * time.Hour),
+}
+
+// handlerRequestPasswordReset mails a reset token to the address if it
+// belongs to an account. The response is 202 either way and the work
+// happens in the background, so neither the status nor the timing reveals
+// which addresses have accounts.
+func (cfg *apiConfig) handlerRequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "Failed decoding parameters: %v", err))
+		return
+	}
+
+	email := strings.ToLower(strings.TrimSpace(params.Email))
+	now := time.Now()
+	if _, ok := cfg.passwordResetThrottle.Allow(email, now); ok && email != "" {
+		cfg.passwordResetThrottle.Failure(email, now)
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(30*time.Second))
+			defer cancel()
+			if err := cfg.sendPasswordReset(ctx, email); err != nil {
+				log.Printf("failed sending a password reset: %v", err)
+			}
+		}()
+	}
+
+	w.WriteHeader(202)
+}
+
+func (cfg *apiConfig) sendPasswordReset(ctx context.Context, email string) error {
+	userDB, err := cfg.db.GetUserByEmail(ctx, email)
+	if err != nil {
+		// most likely no such account, which the requester mustn't learn
+		return nil
+	}
+
+	token, err := auth.MakePasswordResetToken()
+	if err != nil {
+		return err
+	}
+	if err := cfg.db.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashPasswordResetToken(token),
+		UserID:    userDB.ID,
+		ExpiresAt: time.Now().Add(passwordResetDuration),
+	}); err != nil {
+		return fmt.Errorf("failed saving the reset token of user %v: %v", userDB.ID, err)
+	}
+
+	return cfg.mailer.Send(ctx, mail.Message{
+		To:      userDB.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your Chirpy account.\n\n"+
+			"Your reset token is:\n\n%s\n\n"+
+			"Send it with your new password to POST %s/api/password-reset/confirm within %v. It works once.\n\n"+
+			"If you didn't ask for this, you can ignore this email and your password stays the same.\n",
+			token, cfg.baseURL, passwordResetDuration),
+	})
+}
+
+// handlerConfirmPasswordReset sets a new password with a reset token and
+// ends every session of the account, since whoever knew the old password
+// may be logged in.
+func (cfg *apiConfig) handlerConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "Failed decoding parameters: %v", err))
+		return
+	}
+
+	tokenHash := auth.HashPasswordResetToken(params.Token)
+	resetToken, err := cfg.db.GetPasswordResetToken(r.Context(), tokenHash)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write([]byte("Invalid or expired reset token"))
+		return
+	}
+	userDB, err := cfg.db.GetUserByID(r.Context(), resetToken.UserID)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed getting the user: %v", err))
+		return
+	}
+
+	// the policy is checked before the token is used up, so a rejected
+	// password can be retried with the same token
+	if !cfg.checkPasswordPolicy(w, params.Password, userDB.Email) {
+		return
+	}
+	hashedPassword, err := auth.HashPassword(params.Password)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed hashing the password: %v", err))
+		return
+	}
+
+	used, err := cfg.db.UsePasswordResetToken(r.Context(), tokenHash)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed using the reset token: %v", err))
+		return
+	}
+	if used == 0 {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write([]byte("Invalid or expired reset token"))
+		return
+	}
+
+	if _, err := cfg.db.UpdatePasswordUserWithID(r.Context(), database.UpdatePasswordUserWithIDParams{
+		ID:             userDB.ID,
+		HashedPassword: hashedPassword,
+	}); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed updating the password: %v", err))
+		return
+	}
+	if err := cfg.db.DeletePasswordResetTokensForUser(r.Context(), userDB.ID); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed deleting other reset tokens: %v", err))
+		return
+	}
+	if err := cfg.revokeAllCredentials(r.Context(), userDB.ID); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed signing out everywhere: %v", err))
+		return
+	}
+	// proving control of the inbox is enough to lift a lockout
+	resetFailedLogins(r.Context(), cfg.db, userDB)
+
+	w.WriteHeader(204)
+}
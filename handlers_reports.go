@@ -0,0 +1,466 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/marekmchl/Chirpy/internal/database"
+)
+
+var reportReasons = []string{"spam", "harassment", "hate_speech", "violence", "misinformation", "other"}
+
+const defaultSuspensionDays = 7
+
+type reportStruct struct {
+	ID             uuid.UUID  `json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	ReporterID     uuid.UUID  `json:"reporter_id"`
+	ChirpID        *uuid.UUID `json:"chirp_id,omitempty"`
+	ReportedUserID *uuid.UUID `json:"reported_user_id,omitempty"`
+	Reason         string     `json:"reason"`
+	Details        string     `json:"details,omitempty"`
+	Status         string     `json:"status"`
+	ClaimedBy      *uuid.UUID `json:"claimed_by,omitempty"`
+	ClaimedAt      *time.Time `json:"claimed_at,omitempty"`
+	Resolution     string     `json:"resolution,omitempty"`
+	ResolvedAt     *time.Time `json:"resolved_at,omitempty"`
+}
+
+func toReportStruct(dbReport database.Report) reportStruct {
+	report := reportStruct{
+		ID:         dbReport.ID,
+		CreatedAt:  dbReport.CreatedAt,
+		UpdatedAt:  dbReport.UpdatedAt,
+		ReporterID: dbReport.ReporterID,
+		Reason:     dbReport.Reason,
+		Details:    dbReport.Details.String,
+		Status:     dbReport.Status,
+		Resolution: dbReport.Resolution.String,
+	}
+	if dbReport.ChirpID.Valid {
+		report.ChirpID = &dbReport.ChirpID.UUID
+	}
+	if dbReport.ReportedUserID.Valid {
+		report.ReportedUserID = &dbReport.ReportedUserID.UUID
+	}
+	if dbReport.ClaimedBy.Valid {
+		report.ClaimedBy = &dbReport.ClaimedBy.UUID
+	}
+	if dbReport.ClaimedAt.Valid {
+		report.ClaimedAt = &dbReport.ClaimedAt.Time
+	}
+	if dbReport.ResolvedAt.Valid {
+		report.ResolvedAt = &dbReport.ResolvedAt.Time
+	}
+	return report
+}
+
+func isReportReason(reason string) bool {
+	for _, r := range reportReasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
+
+func (cfg *apiConfig) handlerReportChirp(w http.ResponseWriter, r *http.Request) {
+	cfg.createReport(w, r, "chirp")
+}
+
+func (cfg *apiConfig) handlerReportUser(w http.ResponseWriter, r *http.Request) {
+	cfg.createReport(w, r, "user")
+}
+
+// createReport files a report against the chirp or user named by the path.
+// target is either "chirp" or "user".
+func (cfg *apiConfig) createReport(w http.ResponseWriter, r *http.Request, target string) {
+	reqUserID := userIDFromContext(r.Context())
+
+	params := database.CreateReportParams{ReporterID: reqUserID}
+	if target == "chirp" {
+		chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+		if err != nil {
+			w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(400)
+			w.Write(fmt.Appendf([]byte{}, "Failed parsing the ID: %v", err))
+			return
+		}
+		// chirps that aren't public can't be seen, so can't be reported
+		dbChirp, err := cfg.db.GetChirpByID(r.Context(), chirpID)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && (dbChirp.Hidden || dbChirp.Flagged)) {
+			w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(404)
+			w.Write(fmt.Appendf([]byte{}, "Chirp with ID %v not found", chirpID))
+			return
+		}
+		if err != nil {
+			w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(500)
+			w.Write(fmt.Appendf([]byte{}, "Failed getting the chirp: %v", err))
+			return
+		}
+		params.ChirpID = uuid.NullUUID{UUID: chirpID, Valid: true}
+	} else {
+		userID, err := uuid.Parse(r.PathValue("userID"))
+		if err != nil {
+			w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(400)
+			w.Write(fmt.Appendf([]byte{}, "Failed parsing the ID: %v", err))
+			return
+		}
+		if _, err := cfg.db.GetUserByID(r.Context(), userID); err != nil {
+			w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(404)
+			w.Write(fmt.Appendf([]byte{}, "User with ID %v not found", userID))
+			return
+		}
+		params.ReportedUserID = uuid.NullUUID{UUID: userID, Valid: true}
+	}
+
+	type requestBody struct {
+		Reason  string `json:"reason"`
+		Details string `json:"details"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	reqData := requestBody{}
+	if err := decoder.Decode(&reqData); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "Failed decoding data: %v", err))
+		return
+	}
+	if !isReportReason(reqData.Reason) {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "'%v' is not a valid reason, expected one of %v", reqData.Reason, reportReasons))
+		return
+	}
+	params.Reason = reqData.Reason
+	params.Details = sql.NullString{String: reqData.Details, Valid: reqData.Details != ""}
+
+	dbReport, err := cfg.db.CreateReport(r.Context(), params)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed saving the report: %v", err))
+		return
+	}
+
+	reportJson, err := json.Marshal(toReportStruct(dbReport))
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed marshalling the response body: %v", err))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(201)
+	w.Write(reportJson)
+}
+
+func (cfg *apiConfig) handlerGetReports(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = "open"
+	}
+	if status != "open" && status != "claimed" && status != "resolved" {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "'%v' is not one of open, claimed, resolved", status))
+		return
+	}
+
+	dbReports, err := cfg.db.GetReportsByStatus(r.Context(), status)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed getting reports: %v", err))
+		return
+	}
+
+	reports := []reportStruct{}
+	for _, dbReport := range dbReports {
+		reports = append(reports, toReportStruct(dbReport))
+	}
+
+	reportsJson, err := json.Marshal(reports)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed marshalling the response body: %v", err))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(reportsJson)
+}
+
+func (cfg *apiConfig) handlerClaimReport(w http.ResponseWriter, r *http.Request) {
+	moderatorID := userIDFromContext(r.Context())
+
+	reportID, err := uuid.Parse(r.PathValue("reportID"))
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "Failed parsing the ID: %v", err))
+		return
+	}
+
+	dbReport, err := cfg.db.ClaimReport(r.Context(), database.ClaimReportParams{
+		ID:        reportID,
+		ClaimedBy: uuid.NullUUID{UUID: moderatorID, Valid: true},
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(409)
+			w.Write(fmt.Appendf([]byte{}, "Report with ID %v doesn't exist or isn't open", reportID))
+			return
+		}
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed claiming the report: %v", err))
+		return
+	}
+
+	if _, err := cfg.db.CreateModerationAction(r.Context(), database.CreateModerationActionParams{
+		ModeratorID: uuid.NullUUID{UUID: moderatorID, Valid: true},
+		ReportID:    uuid.NullUUID{UUID: reportID, Valid: true},
+		Action:      "claim",
+	}); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed recording the action: %v", err))
+		return
+	}
+
+	reportJson, err := json.Marshal(toReportStruct(dbReport))
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed marshalling the response body: %v", err))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(reportJson)
+}
+
+func (cfg *apiConfig) handlerResolveReport(w http.ResponseWriter, r *http.Request) {
+	moderatorID := userIDFromContext(r.Context())
+
+	reportID, err := uuid.Parse(r.PathValue("reportID"))
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "Failed parsing the ID: %v", err))
+		return
+	}
+
+	type requestBody struct {
+		Action      string `json:"action"`
+		Note        string `json:"note"`
+		SuspendDays int    `json:"suspend_days"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	reqData := requestBody{}
+	if err := decoder.Decode(&reqData); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "Failed decoding data: %v", err))
+		return
+	}
+
+	dbReport, err := cfg.db.GetReportByID(r.Context(), reportID)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(404)
+		w.Write(fmt.Appendf([]byte{}, "Report with ID %v not found", reportID))
+		return
+	}
+	if dbReport.Status != "claimed" || dbReport.ClaimedBy.UUID != moderatorID {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(409)
+		w.Write(fmt.Appendf([]byte{}, "Report has to be claimed by you before it can be resolved"))
+		return
+	}
+
+	action := database.CreateModerationActionParams{
+		ModeratorID: uuid.NullUUID{UUID: moderatorID, Valid: true},
+		ReportID:    uuid.NullUUID{UUID: reportID, Valid: true},
+		Action:      reqData.Action,
+		ChirpID:     dbReport.ChirpID,
+		UserID:      dbReport.ReportedUserID,
+		Note:        sql.NullString{String: reqData.Note, Valid: reqData.Note != ""},
+	}
+
+	switch reqData.Action {
+	case "dismiss":
+	case "hide_chirp":
+		if !dbReport.ChirpID.Valid {
+			w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(400)
+			w.Write(fmt.Appendf([]byte{}, "Report isn't about a chirp"))
+			return
+		}
+	case "suspend_user":
+		if !action.UserID.Valid {
+			chirpDB, err := cfg.db.GetChirpByID(r.Context(), dbReport.ChirpID.UUID)
+			if err != nil {
+				w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+				w.WriteHeader(404)
+				w.Write(fmt.Appendf([]byte{}, "Reported chirp not found"))
+				return
+			}
+			action.UserID = uuid.NullUUID{UUID: chirpDB.UserID, Valid: true}
+		}
+	default:
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "'%v' is not one of dismiss, hide_chirp, suspend_user", reqData.Action))
+		return
+	}
+
+	// the action, the resolution and its record happen together, so a
+	// failure leaves the report open with nothing applied and it can be
+	// retried
+	tx, err := cfg.sqlDB.BeginTx(r.Context(), nil)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed starting a transaction: %v", err))
+		return
+	}
+	defer tx.Rollback()
+	db := cfg.db.WithTx(tx)
+
+	switch reqData.Action {
+	case "hide_chirp":
+		if err := db.HideChirpByID(r.Context(), dbReport.ChirpID.UUID); err != nil {
+			w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(500)
+			w.Write(fmt.Appendf([]byte{}, "Failed hiding the chirp: %v", err))
+			return
+		}
+	case "suspend_user":
+		days := reqData.SuspendDays
+		if days <= 0 {
+			days = defaultSuspensionDays
+		}
+		if _, err := db.SuspendUserWithID(r.Context(), database.SuspendUserWithIDParams{
+			ID:             action.UserID.UUID,
+			SuspendedUntil: sql.NullTime{Time: time.Now().Add(time.Duration(days) * 24 * time.Hour), Valid: true},
+		}); err != nil {
+			w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(500)
+			w.Write(fmt.Appendf([]byte{}, "Failed suspending the user: %v", err))
+			return
+		}
+	}
+
+	dbReport, err = db.ResolveReport(r.Context(), database.ResolveReportParams{
+		ID:         reportID,
+		Resolution: sql.NullString{String: reqData.Action, Valid: true},
+		ClaimedBy:  uuid.NullUUID{UUID: moderatorID, Valid: true},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(409)
+		w.Write(fmt.Appendf([]byte{}, "Report has to be claimed by you before it can be resolved"))
+		return
+	}
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed resolving the report: %v", err))
+		return
+	}
+
+	if _, err := db.CreateModerationAction(r.Context(), action); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed recording the action: %v", err))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed resolving the report: %v", err))
+		return
+	}
+
+	reportJson, err := json.Marshal(toReportStruct(dbReport))
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed marshalling the response body: %v", err))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(reportJson)
+}
+
+func (cfg *apiConfig) handlerGetModerationActions(w http.ResponseWriter, r *http.Request) {
+	type actionStruct struct {
+		ID          uuid.UUID  `json:"id"`
+		CreatedAt   time.Time  `json:"created_at"`
+		ModeratorID *uuid.UUID `json:"moderator_id,omitempty"`
+		ReportID    *uuid.UUID `json:"report_id,omitempty"`
+		Action      string     `json:"action"`
+		ChirpID     *uuid.UUID `json:"chirp_id,omitempty"`
+		UserID      *uuid.UUID `json:"user_id,omitempty"`
+		Note        string     `json:"note,omitempty"`
+	}
+
+	dbActions, err := cfg.db.GetAllModerationActions(r.Context())
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed getting moderation actions: %v", err))
+		return
+	}
+
+	actions := []actionStruct{}
+	for _, dbAction := range dbActions {
+		action := actionStruct{
+			ID:        dbAction.ID,
+			CreatedAt: dbAction.CreatedAt,
+			Action:    dbAction.Action,
+			Note:      dbAction.Note.String,
+		}
+		if dbAction.ModeratorID.Valid {
+			action.ModeratorID = &dbAction.ModeratorID.UUID
+		}
+		if dbAction.ReportID.Valid {
+			action.ReportID = &dbAction.ReportID.UUID
+		}
+		if dbAction.ChirpID.Valid {
+			action.ChirpID = &dbAction.ChirpID.UUID
+		}
+		if dbAction.UserID.Valid {
+			action.UserID = &dbAction.UserID.UUID
+		}
+		actions = append(actions, action)
+	}
+
+	actionsJson, err := json.Marshal(actions)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed marshalling the response body: %v", err))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(actionsJson)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/marekmchl/Chirpy/internal/auth"
+	"github.com/marekmchl/Chirpy/internal/database"
+)
+
+// loadRevocations fills the in-memory revocation list from the database.
+func (cfg *apiConfig) loadRevocations(ctx context.Context) error {
+	if err := cfg.db.DeleteExpiredRevokedAccessTokens(ctx); err != nil {
+		return fmt.Errorf("failed deleting expired revoked tokens: %v", err)
+	}
+	dbTokens, err := cfg.db.GetUnexpiredRevokedAccessTokens(ctx)
+	if err != nil {
+		return fmt.Errorf("failed getting revoked tokens: %v", err)
+	}
+	for _, dbToken := range dbTokens {
+		cfg.revocations.RevokeToken(dbToken.Jti, dbToken.ExpiresAt)
+	}
+
+	dbUsers, err := cfg.db.GetTokensIssuedBefore(ctx)
+	if err != nil {
+		return fmt.Errorf("failed getting token cutoffs: %v", err)
+	}
+	for _, dbUser := range dbUsers {
+		cfg.revocations.RevokeIssuedBefore(dbUser.ID, dbUser.TokensIssuedBefore.Time)
+	}
+	return nil
+}
+
+func (cfg *apiConfig) revokeAccessToken(ctx context.Context, claims auth.TokenClaims) error {
+	if err := cfg.db.CreateRevokedAccessToken(ctx, database.CreateRevokedAccessTokenParams{
+		Jti:       claims.ID,
+		UserID:    claims.UserID,
+		ExpiresAt: claims.ExpiresAt,
+	}); err != nil {
+		return err
+	}
+	cfg.revocations.RevokeToken(claims.ID, claims.ExpiresAt)
+	return nil
+}
+
+// revokeTokensIssuedBefore revokes every access token of the user issued
+// before t.
+func (cfg *apiConfig) revokeTokensIssuedBefore(ctx context.Context, userID uuid.UUID, t time.Time) error {
+	t = t.Truncate(time.Second)
+	if err := cfg.db.SetTokensIssuedBeforeUserWithID(ctx, database.SetTokensIssuedBeforeUserWithIDParams{
+		ID:                 userID,
+		TokensIssuedBefore: sql.NullTime{Time: t, Valid: true},
+	}); err != nil {
+		return err
+	}
+	cfg.revocations.RevokeIssuedBefore(userID, t)
+	return nil
+}
+
+// revokeAllCredentials signs the user out everywhere: their sessions, the
+// OAuth clients acting for them, their personal access tokens and every
+// access token issued so far.
+func (cfg *apiConfig) revokeAllCredentials(ctx context.Context, userID uuid.UUID) error {
+	// OAuth client refresh tokens are stored with the session ones
+	if err := cfg.db.RevokeAllRefreshTokensForUser(ctx, userID); err != nil {
+		return fmt.Errorf("failed revoking sessions: %v", err)
+	}
+	if err := cfg.db.RevokeAllPersonalAccessTokensForUser(ctx, userID); err != nil {
+		return fmt.Errorf("failed revoking personal access tokens: %v", err)
+	}
+	if err := cfg.revokeTokensIssuedBefore(ctx, userID, time.Now()); err != nil {
+		return fmt.Errorf("failed revoking access tokens: %v", err)
+	}
+	return nil
+}
+
+// clientIP returns the address the request came from, without the port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// handlerGetSessions lists the user's logins and the OAuth clients acting for
+// them. A session is a refresh token family, represented by its newest token.
+func (cfg *apiConfig) handlerGetSessions(w http.ResponseWriter, r *http.Request) {
+	reqUserID := userIDFromContext(r.Context())
+
+	type sessionStruct struct {
+		ID         uuid.UUID  `json:"id"`
+		UserAgent  string     `json:"user_agent"`
+		IpAddress  string     `json:"ip_address"`
+		LastUsedAt time.Time  `json:"last_used_at"`
+		ExpiresAt  time.Time  `json:"expires_at"`
+		ClientID   *uuid.UUID `json:"client_id,omitempty"`
+	}
+
+	dbTokens, err := cfg.db.GetActiveRefreshTokensForUser(r.Context(), reqUserID)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed getting sessions: %v", err))
+		return
+	}
+
+	sessions := []sessionStruct{}
+	for _, dbToken := range dbTokens {
+		session := sessionStruct{
+			ID:         dbToken.FamilyID,
+			UserAgent:  dbToken.UserAgent,
+			IpAddress:  dbToken.IpAddress,
+			LastUsedAt: dbToken.LastUsedAt,
+			ExpiresAt:  dbToken.ExpiresAt,
+		}
+		if dbToken.ClientID.Valid {
+			session.ClientID = &dbToken.ClientID.UUID
+		}
+		sessions = append(sessions, session)
+	}
+
+	sessionsJson, err := json.Marshal(sessions)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed marshalling the response body: %v", err))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(sessionsJson)
+}
+
+func (cfg *apiConfig) handlerDeleteSession(w http.ResponseWriter, r *http.Request) {
+	reqUserID := userIDFromContext(r.Context())
+
+	sessionID, err := uuid.Parse(r.PathValue("sessionID"))
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "Failed parsing the ID: %v", err))
+		return
+	}
+
+	revoked, err := cfg.db.RevokeRefreshTokenFamilyForUser(r.Context(), database.RevokeRefreshTokenFamilyForUserParams{
+		FamilyID: sessionID,
+		UserID:   reqUserID,
+	})
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed revoking the session: %v", err))
+		return
+	}
+	if revoked == 0 {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(404)
+		w.Write(fmt.Appendf([]byte{}, "Session with ID %v not found", sessionID))
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+func (cfg *apiConfig) handlerRevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	reqUserID := userIDFromContext(r.Context())
+
+	if err := cfg.revokeAllCredentials(r.Context(), reqUserID); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed signing out everywhere: %v", err))
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// handlerLogout revokes the access token the request was made with.
+func (cfg *apiConfig) handlerLogout(w http.ResponseWriter, r *http.Request) {
+	if err := cfg.revokeAccessToken(r.Context(), claimsFromContext(r.Context())); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed revoking the token: %v", err))
+		return
+	}
+
+	w.WriteHeader(204)
+}
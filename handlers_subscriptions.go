@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/marekmchl/Chirpy/internal/database"
+	"github.com/marekmchl/Chirpy/internal/subscription"
+)
+
+const (
+	// defaultSubscriptionPeriod is used when Polka doesn't say when the paid
+	// period ends.
+	defaultSubscriptionPeriod  = time.Duration(30 * 24 * time.Hour)
+	subscriptionExpiryInterval = time.Duration(10 * time.Minute)
+)
+
+// applySubscriptionEvent updates the user's Chirpy Red subscription and
+// membership for a Polka event, see subscription.Apply. Events with an ID
+// are only applied once, however often Polka delivers them.
+func (cfg *apiConfig) applySubscriptionEvent(ctx context.Context, eventID string, userID uuid.UUID, event subscription.Event) error {
+	tx, err := cfg.sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	db := cfg.db.WithTx(tx)
+
+	if eventID != "" {
+		recorded, err := db.RecordPolkaEvent(ctx, eventID)
+		if err != nil {
+			return err
+		}
+		if recorded == 0 {
+			return nil
+		}
+	}
+
+	dbSubscription, err := db.LockSubscriptionForUser(ctx, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	state, changed := subscription.Apply(toSubscriptionState(dbSubscription), err == nil, event, defaultSubscriptionPeriod)
+	if changed {
+		if err := db.SaveSubscription(ctx, database.SaveSubscriptionParams{
+			UserID:           userID,
+			Status:           state.Status,
+			StartedAt:        state.StartedAt,
+			CurrentPeriodEnd: state.CurrentPeriodEnd,
+			CancelledAt:      sql.NullTime{Time: state.CancelledAt, Valid: !state.CancelledAt.IsZero()},
+			LastEventAt:      state.LastEventAt,
+		}); err != nil {
+			return err
+		}
+		if _, err := db.SetChirpyRedUserWithID(ctx, database.SetChirpyRedUserWithIDParams{
+			ID:          userID,
+			IsChirpyRed: state.IsMember(time.Now()),
+		}); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func toSubscriptionState(dbSubscription database.Subscription) subscription.State {
+	return subscription.State{
+		Status:           dbSubscription.Status,
+		StartedAt:        dbSubscription.StartedAt,
+		CurrentPeriodEnd: dbSubscription.CurrentPeriodEnd,
+		CancelledAt:      dbSubscription.CancelledAt.Time,
+		LastEventAt:      dbSubscription.LastEventAt,
+	}
+}
+
+// expireSubscriptionsPeriodically ends Chirpy Red membership for the users
+// whose paid period is over without a renewal, and forgets event IDs long
+// after Polka stopped redelivering them.
+func (cfg *apiConfig) expireSubscriptionsPeriodically() {
+	ticker := time.NewTicker(subscriptionExpiryInterval)
+	go func() {
+		for {
+			expired, err := cfg.db.ExpireSubscriptions(context.Background())
+			if err != nil {
+				log.Printf("failed expiring subscriptions: %v", err)
+			} else if expired > 0 {
+				log.Printf("expired %d Chirpy Red subscriptions", expired)
+			}
+			if err := cfg.db.DeleteOldPolkaEvents(context.Background()); err != nil {
+				log.Printf("failed deleting old Polka events: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
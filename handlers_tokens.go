@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/marekmchl/Chirpy/internal/auth"
+	"github.com/marekmchl/Chirpy/internal/database"
+)
+
+type personalAccessTokenStruct struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Token      string     `json:"token,omitempty"`
+}
+
+func toPersonalAccessTokenStruct(dbToken database.PersonalAccessToken) personalAccessTokenStruct {
+	token := personalAccessTokenStruct{
+		ID:        dbToken.ID,
+		CreatedAt: dbToken.CreatedAt,
+		Name:      dbToken.Name,
+		Prefix:    dbToken.TokenPrefix,
+		Scopes:    auth.SplitScopes(dbToken.Scopes),
+	}
+	if dbToken.ExpiresAt.Valid {
+		token.ExpiresAt = &dbToken.ExpiresAt.Time
+	}
+	if dbToken.LastUsedAt.Valid {
+		token.LastUsedAt = &dbToken.LastUsedAt.Time
+	}
+	return token
+}
+
+// validatePersonalAccessToken looks up a personal access token, records its
+// use and returns claims carrying its scopes. Tokens never act with more
+// than the user role, whatever the owner's role is.
+func (cfg *apiConfig) validatePersonalAccessToken(ctx context.Context, token string) (auth.TokenClaims, error) {
+	dbTokens, err := cfg.db.GetPersonalAccessTokensByPrefix(ctx, auth.PersonalAccessTokenPrefix(token))
+	if err != nil {
+		return auth.TokenClaims{}, err
+	}
+	for _, dbToken := range dbTokens {
+		if !auth.CheckPersonalAccessTokenHash(dbToken.TokenHash, token) {
+			continue
+		}
+		if dbToken.RevokedAt.Valid {
+			return auth.TokenClaims{}, auth.ErrTokenRevoked
+		}
+		if dbToken.ExpiresAt.Valid && dbToken.ExpiresAt.Time.Before(time.Now()) {
+			return auth.TokenClaims{}, auth.ErrTokenExpired
+		}
+		if err := cfg.db.UpdatePersonalAccessTokenLastUsed(ctx, dbToken.ID); err != nil {
+			return auth.TokenClaims{}, err
+		}
+		return auth.TokenClaims{
+			UserID:    dbToken.UserID,
+			Role:      auth.RoleUser,
+			ID:        dbToken.ID.String(),
+			IssuedAt:  dbToken.CreatedAt,
+			ExpiresAt: dbToken.ExpiresAt.Time,
+			Scopes:    auth.SplitScopes(dbToken.Scopes),
+		}, nil
+	}
+	return auth.TokenClaims{}, fmt.Errorf("personal access token not found")
+}
+
+func (cfg *apiConfig) handlerCreatePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	reqUserID := userIDFromContext(r.Context())
+
+	type parameters struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "Failed decoding parameters: %v", err))
+		return
+	}
+	if params.Name == "" {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write([]byte("Token name is required"))
+		return
+	}
+	if params.ExpiresInDays < 0 {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write([]byte("expires_in_days can't be negative"))
+		return
+	}
+	scopes, err := auth.ParseScopes(params.Scopes)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "Invalid scopes: %v", err))
+		return
+	}
+
+	token, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed making the token: %v", err))
+		return
+	}
+	expiresAt := sql.NullTime{}
+	if params.ExpiresInDays > 0 {
+		expiresAt = sql.NullTime{Time: time.Now().AddDate(0, 0, params.ExpiresInDays), Valid: true}
+	}
+	dbToken, err := cfg.db.CreatePersonalAccessToken(r.Context(), database.CreatePersonalAccessTokenParams{
+		UserID:      reqUserID,
+		Name:        params.Name,
+		TokenHash:   auth.HashPersonalAccessToken(token),
+		TokenPrefix: auth.PersonalAccessTokenPrefix(token),
+		Scopes:      auth.FormatScopes(scopes),
+		ExpiresAt:   expiresAt,
+	})
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed saving the token: %v", err))
+		return
+	}
+
+	// The token itself is only ever shown in this response.
+	respToken := toPersonalAccessTokenStruct(dbToken)
+	respToken.Token = token
+	tokenJson, err := json.Marshal(respToken)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed marshalling the response body: %v", err))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(201)
+	w.Write(tokenJson)
+}
+
+func (cfg *apiConfig) handlerGetPersonalAccessTokens(w http.ResponseWriter, r *http.Request) {
+	reqUserID := userIDFromContext(r.Context())
+
+	dbTokens, err := cfg.db.GetActivePersonalAccessTokensForUser(r.Context(), reqUserID)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed getting tokens: %v", err))
+		return
+	}
+
+	tokens := []personalAccessTokenStruct{}
+	for _, dbToken := range dbTokens {
+		tokens = append(tokens, toPersonalAccessTokenStruct(dbToken))
+	}
+
+	tokensJson, err := json.Marshal(tokens)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed marshalling the response body: %v", err))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(tokensJson)
+}
+
+func (cfg *apiConfig) handlerRevokePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	reqUserID := userIDFromContext(r.Context())
+
+	tokenID, err := uuid.Parse(r.PathValue("tokenID"))
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "Failed parsing the ID: %v", err))
+		return
+	}
+
+	revoked, err := cfg.db.RevokePersonalAccessTokenForUser(r.Context(), database.RevokePersonalAccessTokenForUserParams{
+		ID:     tokenID,
+		UserID: reqUserID,
+	})
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed revoking the token: %v", err))
+		return
+	}
+	if revoked == 0 {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(404)
+		w.Write(fmt.Appendf([]byte{}, "Token with ID %v not found", tokenID))
+		return
+	}
+
+	w.WriteHeader(204)
+}
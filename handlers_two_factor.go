@@ -0,0 +1,462 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/marekmchl/Chirpy/internal/auth"
+	"github.com/marekmchl/Chirpy/internal/database"
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	loginChallengeDuration    = time.Duration(5 * time.Minute)
+	maxLoginChallengeAttempts = 5
+	recoveryCodeCount         = 10
+	totpIssuer                = "Chirpy"
+)
+
+// respondWithLoginChallenge answers a correct password of a user with 2FA
+// enabled. The challenge token and a second factor are then exchanged for
+// the session's tokens at /api/login/2fa.
+func (cfg *apiConfig) respondWithLoginChallenge(w http.ResponseWriter, r *http.Request, userDB database.User) {
+	challenge, err := auth.MakeLoginChallenge()
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed making the login challenge: %v", err))
+		return
+	}
+	expiresAt := time.Now().Add(loginChallengeDuration)
+	if err := cfg.db.CreateLoginChallenge(r.Context(), database.CreateLoginChallengeParams{
+		TokenHash: auth.HashLoginChallenge(challenge),
+		UserID:    userDB.ID,
+		ExpiresAt: expiresAt,
+	}); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed saving the login challenge: %v", err))
+		return
+	}
+
+	type challengeStruct struct {
+		TwoFactorRequired bool      `json:"two_factor_required"`
+		ChallengeToken    string    `json:"challenge_token"`
+		ExpiresAt         time.Time `json:"expires_at"`
+	}
+	challengeJson, err := json.Marshal(challengeStruct{
+		TwoFactorRequired: true,
+		ChallengeToken:    challenge,
+		ExpiresAt:         expiresAt,
+	})
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed marshalling the response body: %v", err))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(challengeJson)
+}
+
+// checkSecondFactor accepts either a current TOTP code or an unused recovery
+// code, using it up.
+func checkSecondFactor(ctx context.Context, db *database.Queries, userDB database.User, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		counter, ok := auth.ValidateTOTP(userDB.TotpSecret.String, code, time.Now(), userDB.TotpLastCounter)
+		if !ok {
+			return false, nil
+		}
+		// the conditional update stops a code from being used twice by
+		// concurrent requests
+		updated, err := db.SetTOTPLastCounterUserWithID(ctx, database.SetTOTPLastCounterUserWithIDParams{
+			ID:              userDB.ID,
+			TotpLastCounter: counter,
+		})
+		return updated > 0, err
+	}
+
+	if recoveryCode == "" {
+		return false, nil
+	}
+	dbCodes, err := db.GetUnusedRecoveryCodesForUser(ctx, userDB.ID)
+	if err != nil {
+		return false, err
+	}
+	recoveryCode = auth.NormalizeRecoveryCode(recoveryCode)
+	for _, dbCode := range dbCodes {
+		if auth.CheckPasswordHash(dbCode.CodeHash, recoveryCode) != nil {
+			continue
+		}
+		used, err := db.UseRecoveryCode(ctx, dbCode.ID)
+		return used > 0, err
+	}
+	return false, nil
+}
+
+func (cfg *apiConfig) handlerLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "Failed decoding parameters: %v", err))
+		return
+	}
+
+	challengeHash := auth.HashLoginChallenge(params.ChallengeToken)
+	challenge, err := cfg.db.GetLoginChallenge(r.Context(), challengeHash)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(401)
+		w.Write([]byte("Invalid or expired challenge token"))
+		return
+	}
+	challenge, err = cfg.db.IncrementLoginChallengeAttempts(r.Context(), challengeHash)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed updating the login challenge: %v", err))
+		return
+	}
+	if challenge.Attempts > maxLoginChallengeAttempts {
+		cfg.db.DeleteLoginChallenge(r.Context(), challengeHash)
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(401)
+		w.Write([]byte("Too many attempts, log in again"))
+		return
+	}
+
+	userDB, err := cfg.db.GetUserByID(r.Context(), challenge.UserID)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(401)
+		w.Write([]byte("Invalid or expired challenge token"))
+		return
+	}
+	if restriction := accountRestriction(userDB.Banned, userDB.SuspendedUntil); restriction != "" {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(403)
+		w.Write([]byte(restriction))
+		return
+	}
+	userDB, wait, err := claimLoginAttempt(r.Context(), cfg.db, cfg.accountLoginPolicy, userDB)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed counting the login attempt: %v", err))
+		return
+	}
+	if wait > 0 {
+		respondWithTooManyAttempts(w, wait, "Too many failed logins, try again later")
+		return
+	}
+
+	ok, err := checkSecondFactor(r.Context(), cfg.db, userDB, params.Code, params.RecoveryCode)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed checking the code: %v", err))
+		return
+	}
+	if !ok {
+		recordFailedLogin(cfg.accountLoginPolicy, userDB)
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(401)
+		w.Write([]byte("Invalid code"))
+		return
+	}
+
+	if err := cfg.db.DeleteLoginChallenge(r.Context(), challengeHash); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed deleting the login challenge: %v", err))
+		return
+	}
+	resetFailedLogins(r.Context(), cfg.db, userDB)
+	cfg.respondWithLoginTokens(w, r, userDB)
+}
+
+// handlerEnrollTwoFactor generates a new TOTP secret for the user. It only
+// takes effect once confirmed with a code from the authenticator app. The
+// current password is required, so a stolen access token can't be used to
+// lock the owner out with someone else's authenticator.
+func (cfg *apiConfig) handlerEnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	reqUserID := userIDFromContext(r.Context())
+
+	type parameters struct {
+		CurrentPassword string `json:"current_password"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "Failed decoding parameters: %v", err))
+		return
+	}
+
+	userDB, err := cfg.db.GetUserByID(r.Context(), reqUserID)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed getting the user: %v", err))
+		return
+	}
+	if !cfg.checkCurrentPassword(w, r, userDB, params.CurrentPassword) {
+		return
+	}
+	if userDB.TotpEnabled {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(409)
+		w.Write([]byte("Two-factor authentication is already enabled"))
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed generating the secret: %v", err))
+		return
+	}
+	if _, err := cfg.db.SetTOTPSecretUserWithID(r.Context(), database.SetTOTPSecretUserWithIDParams{
+		ID:         reqUserID,
+		TotpSecret: sql.NullString{String: secret, Valid: true},
+	}); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed saving the secret: %v", err))
+		return
+	}
+
+	uri := auth.TOTPURI(secret, totpIssuer, userDB.Email)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed encoding the QR code: %v", err))
+		return
+	}
+
+	type enrollmentStruct struct {
+		Secret     string `json:"secret"`
+		OtpauthURI string `json:"otpauth_uri"`
+		QRCodePNG  string `json:"qr_code_png"`
+	}
+	enrollmentJson, err := json.Marshal(enrollmentStruct{
+		Secret:     secret,
+		OtpauthURI: uri,
+		QRCodePNG:  base64.StdEncoding.EncodeToString(png),
+	})
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed marshalling the response body: %v", err))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Add("Cache-Control", "no-store")
+	w.WriteHeader(200)
+	w.Write(enrollmentJson)
+}
+
+// handlerConfirmTwoFactor enables 2FA once the user proves their app
+// produces valid codes, and hands out the recovery codes.
+func (cfg *apiConfig) handlerConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	reqUserID := userIDFromContext(r.Context())
+
+	type parameters struct {
+		CurrentPassword string `json:"current_password"`
+		Code            string `json:"code"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "Failed decoding parameters: %v", err))
+		return
+	}
+
+	userDB, err := cfg.db.GetUserByID(r.Context(), reqUserID)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed getting the user: %v", err))
+		return
+	}
+	if !cfg.checkCurrentPassword(w, r, userDB, params.CurrentPassword) {
+		return
+	}
+	if userDB.TotpEnabled {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(409)
+		w.Write([]byte("Two-factor authentication is already enabled"))
+		return
+	}
+	if !userDB.TotpSecret.Valid {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write([]byte("Two-factor enrollment hasn't been started"))
+		return
+	}
+	counter, ok := auth.ValidateTOTP(userDB.TotpSecret.String, params.Code, time.Now(), 0)
+	if !ok {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(401)
+		w.Write([]byte("Invalid code"))
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed generating recovery codes: %v", err))
+		return
+	}
+	if err := cfg.db.DeleteRecoveryCodesForUser(r.Context(), reqUserID); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed deleting old recovery codes: %v", err))
+		return
+	}
+	for _, code := range codes {
+		codeHash, err := auth.HashPassword(code)
+		if err != nil {
+			w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(500)
+			w.Write(fmt.Appendf([]byte{}, "Failed hashing a recovery code: %v", err))
+			return
+		}
+		if err := cfg.db.CreateRecoveryCode(r.Context(), database.CreateRecoveryCodeParams{
+			UserID:   reqUserID,
+			CodeHash: codeHash,
+		}); err != nil {
+			w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(500)
+			w.Write(fmt.Appendf([]byte{}, "Failed saving a recovery code: %v", err))
+			return
+		}
+	}
+
+	if err := cfg.db.EnableTOTPUserWithID(r.Context(), database.EnableTOTPUserWithIDParams{
+		ID:              reqUserID,
+		TotpLastCounter: counter,
+	}); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed enabling two-factor authentication: %v", err))
+		return
+	}
+
+	type recoveryCodesStruct struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	codesJson, err := json.Marshal(recoveryCodesStruct{RecoveryCodes: codes})
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed marshalling the response body: %v", err))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Add("Cache-Control", "no-store")
+	w.WriteHeader(200)
+	w.Write(codesJson)
+}
+
+// handlerDisableTwoFactor turns 2FA off, which takes the current password
+// and a valid code so a stolen access token alone isn't enough. Wrong
+// guesses of either count towards the login lockout.
+func (cfg *apiConfig) handlerDisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	reqUserID := userIDFromContext(r.Context())
+
+	type parameters struct {
+		CurrentPassword string `json:"current_password"`
+		Code            string `json:"code"`
+		RecoveryCode    string `json:"recovery_code"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write(fmt.Appendf([]byte{}, "Failed decoding parameters: %v", err))
+		return
+	}
+
+	userDB, err := cfg.db.GetUserByID(r.Context(), reqUserID)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed getting the user: %v", err))
+		return
+	}
+	if !cfg.checkCurrentPassword(w, r, userDB, params.CurrentPassword) {
+		return
+	}
+	if !userDB.TotpEnabled {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(409)
+		w.Write([]byte("Two-factor authentication isn't enabled"))
+		return
+	}
+	userDB, wait, err := claimLoginAttempt(r.Context(), cfg.db, cfg.accountLoginPolicy, userDB)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed counting the login attempt: %v", err))
+		return
+	}
+	if wait > 0 {
+		respondWithTooManyAttempts(w, wait, "Too many failed logins, try again later")
+		return
+	}
+	ok, err := checkSecondFactor(r.Context(), cfg.db, userDB, params.Code, params.RecoveryCode)
+	if err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed checking the code: %v", err))
+		return
+	}
+	if !ok {
+		recordFailedLogin(cfg.accountLoginPolicy, userDB)
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(401)
+		w.Write([]byte("Invalid code"))
+		return
+	}
+	releaseLoginAttempt(r.Context(), cfg.db, userDB)
+
+	if err := cfg.db.DisableTOTPUserWithID(r.Context(), reqUserID); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed disabling two-factor authentication: %v", err))
+		return
+	}
+	if err := cfg.db.DeleteRecoveryCodesForUser(r.Context(), reqUserID); err != nil {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(fmt.Appendf([]byte{}, "Failed deleting recovery codes: %v", err))
+		return
+	}
+
+	w.WriteHeader(204)
+}
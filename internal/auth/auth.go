@@ -2,7 +2,10 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -10,76 +13,202 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
-func HashPassword(password string) (string, error) {
-	hashB, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
-	if err != nil {
-		return "", err
-	}
-	return string(hashB), nil
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+var roleRanks = map[string]int{
+	RoleUser:      1,
+	RoleModerator: 2,
+	RoleAdmin:     3,
 }
 
-func CheckPasswordHash(hash, password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+func IsValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	token := jwt.NewWithClaims(
-		jwt.SigningMethodHS256,
-		jwt.RegisteredClaims{
-			Issuer:    "chirpy",
-			IssuedAt:  &jwt.NumericDate{Time: time.Now()},
-			ExpiresAt: &jwt.NumericDate{Time: time.Now().Add(expiresIn)},
-			Subject:   userID.String(),
-		},
-	)
-	signed, err := token.SignedString([]byte(tokenSecret))
+// HasRole reports whether role grants at least the permissions of required.
+// Unknown roles grant nothing.
+func HasRole(role, required string) bool {
+	rank, ok := roleRanks[role]
+	return ok && rank >= roleRanks[required]
+}
+
+const Issuer = "chirpy"
+
+var (
+	ErrTokenMalformed        = errors.New("token malformed")
+	ErrTokenSignatureInvalid = errors.New("token signature invalid")
+	ErrTokenExpired          = errors.New("token expired")
+	ErrTokenClaimsInvalid    = errors.New("token claims invalid")
+	ErrTokenRevoked          = errors.New("token revoked")
+)
+
+// Claims are the claims of an access token. Scope and ClientID are only set
+// on tokens issued to OAuth clients, Email only on email verification
+// tokens.
+type Claims struct {
+	Role     string `json:"role,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+	Email    string `json:"email,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// MakeJWT signs an access token for audience with the active key of keys and
+// names that key in the kid header.
+func MakeJWT(userID uuid.UUID, role string, keys *Keyring, audience string, expiresIn time.Duration) (string, error) {
+	return signJWT(Claims{Role: role}, userID, keys, audience, expiresIn)
+}
+
+// MakeClientJWT signs an access token that lets an OAuth client act for the
+// user within scopes.
+func MakeClientJWT(userID, clientID uuid.UUID, scopes []string, keys *Keyring, audience string, expiresIn time.Duration) (string, error) {
+	return signJWT(Claims{
+		Role:     RoleUser,
+		Scope:    FormatScopes(scopes),
+		ClientID: clientID.String(),
+	}, userID, keys, audience, expiresIn)
+}
+
+// signJWT fills in the registered claims and signs the token. A token ID
+// already set in claims is kept, otherwise a random one is used.
+func signJWT(claims Claims, userID uuid.UUID, keys *Keyring, audience string, expiresIn time.Duration) (string, error) {
+	key := keys.ActiveKey()
+	id := claims.ID
+	if id == "" {
+		id = uuid.New().String()
+	}
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    Issuer,
+		IssuedAt:  &jwt.NumericDate{Time: time.Now()},
+		ExpiresAt: &jwt.NumericDate{Time: time.Now().Add(expiresIn)},
+		Subject:   userID.String(),
+		ID:        id,
+	}
+	if audience != "" {
+		claims.Audience = jwt.ClaimStrings{audience}
+	}
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.ID
+	signed, err := token.SignedString(key.signingKey())
 	if err != nil {
 		return "", fmt.Errorf("token signing failed with: %v", err)
 	}
 	return signed, nil
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	type MyCustomClaims struct {
-		Issuer    string           `json:"issuer"`
-		IssuedAt  *jwt.NumericDate `json:"issued_at"`
-		ExpiresAt *jwt.NumericDate `json:"expires_at"`
-		Subject   string           `json:"subject"`
-		jwt.RegisteredClaims
+// TokenClaims are the claims of a validated access token. Scopes is only set
+// for personal access tokens and tokens of OAuth clients, see HasScope.
+type TokenClaims struct {
+	UserID    uuid.UUID
+	Role      string
+	ID        string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	Scopes    []string
+	ClientID  uuid.UUID
+	Email     string
+}
+
+type RevocationChecker interface {
+	IsRevoked(claims TokenClaims) bool
+}
+
+// ValidationOptions control what ValidateJWTClaims accepts on top of a valid
+// signature. An empty Audience doesn't check the aud claim, Leeway is the
+// clock skew allowed for exp, nbf and iat, and a nil Revocations skips the
+// revocation check.
+type ValidationOptions struct {
+	Audience    string
+	Leeway      time.Duration
+	Revocations RevocationChecker
+}
+
+func ValidateJWT(tokenString string, keys *Keyring, opts ValidationOptions) (uuid.UUID, error) {
+	claims, err := ValidateJWTClaims(tokenString, keys, opts)
+	return claims.UserID, err
+}
+
+// ValidateJWTClaims checks the signature against the key named by the kid
+// header with that key's algorithm, the issuer, audience and expiry, and that
+// the token hasn't been revoked. Errors wrap one of the ErrToken* errors.
+func ValidateJWTClaims(tokenString string, keys *Keyring, opts ValidationOptions) (TokenClaims, error) {
+	parserOptions := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{AlgorithmHS256, AlgorithmEdDSA, AlgorithmRS256}),
+		jwt.WithIssuer(Issuer),
+		jwt.WithLeeway(opts.Leeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	}
+	if opts.Audience != "" {
+		parserOptions = append(parserOptions, jwt.WithAudience(opts.Audience))
 	}
 
-	token, err := jwt.ParseWithClaims(
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(
 		tokenString,
-		&MyCustomClaims{},
-		jwt.Keyfunc(
-			func(token *jwt.Token) (any, error) {
-				return []byte(tokenSecret), nil
-			},
-		),
+		claims,
+		func(token *jwt.Token) (any, error) {
+			kid, _ := token.Header["kid"].(string)
+			key, ok := keys.Key(kid)
+			if !ok {
+				return nil, fmt.Errorf("unknown signing key %q", kid)
+			}
+			if token.Method.Alg() != key.algorithm() {
+				return nil, fmt.Errorf("unexpected signing method %v for key %q", token.Method.Alg(), kid)
+			}
+			return key.verificationKey(), nil
+		},
+		parserOptions...,
 	)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("token parsing failed with: %v", err)
+		switch {
+		case errors.Is(err, jwt.ErrTokenMalformed):
+			return TokenClaims{}, fmt.Errorf("%w: %v", ErrTokenMalformed, err)
+		case errors.Is(err, jwt.ErrTokenSignatureInvalid), errors.Is(err, jwt.ErrTokenUnverifiable):
+			return TokenClaims{}, fmt.Errorf("%w: %v", ErrTokenSignatureInvalid, err)
+		case errors.Is(err, jwt.ErrTokenExpired):
+			return TokenClaims{}, fmt.Errorf("%w: %v", ErrTokenExpired, err)
+		default:
+			return TokenClaims{}, fmt.Errorf("%w: %v", ErrTokenClaimsInvalid, err)
+		}
 	}
 
-	claims, ok := token.Claims.(*MyCustomClaims)
-	if !ok {
-		return uuid.Nil, fmt.Errorf("claims casting failed")
+	id, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return TokenClaims{}, fmt.Errorf("%w: subject parsing failed with: %v", ErrTokenClaimsInvalid, err)
 	}
 
-	subject, err := claims.GetSubject()
-	if err != nil {
-		return uuid.Nil, fmt.Errorf("subject get failed with: %v", err)
+	result := TokenClaims{
+		UserID:    id,
+		Role:      claims.Role,
+		ID:        claims.ID,
+		ExpiresAt: claims.ExpiresAt.Time,
+		Email:     claims.Email,
+	}
+	if claims.IssuedAt != nil {
+		result.IssuedAt = claims.IssuedAt.Time
+	}
+	if claims.ClientID != "" {
+		clientID, err := uuid.Parse(claims.ClientID)
+		if err != nil {
+			return TokenClaims{}, fmt.Errorf("%w: client_id parsing failed with: %v", ErrTokenClaimsInvalid, err)
+		}
+		result.ClientID = clientID
+		result.Scopes = SplitScopes(claims.Scope)
 	}
 
-	id, err := uuid.Parse(subject)
-	if err != nil {
-		return uuid.Nil, fmt.Errorf("subject parsing failed with: %v", err)
+	if opts.Revocations != nil && opts.Revocations.IsRevoked(result) {
+		return TokenClaims{}, ErrTokenRevoked
 	}
 
-	return id, nil
+	return result, nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -103,6 +232,28 @@ func MakeRefreshToken() (string, error) {
 	return hex.EncodeToString(refreshTokenBytes), nil
 }
 
+const refreshTokenPrefixLength = 16
+
+// HashRefreshToken returns the hex SHA-256 of a refresh token, which is what
+// gets stored instead of the token itself.
+func HashRefreshToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// RefreshTokenPrefix returns the non-secret part of a refresh token used to
+// look it up.
+func RefreshTokenPrefix(token string) string {
+	if len(token) < refreshTokenPrefixLength {
+		return token
+	}
+	return token[:refreshTokenPrefixLength]
+}
+
+func CheckRefreshTokenHash(hash, token string) bool {
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(HashRefreshToken(token))) == 1
+}
+
 func GetAPIKey(headers http.Header) (string, error) {
 	authString := headers.Get("Authorization")
 
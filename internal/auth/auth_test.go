@@ -1,10 +1,12 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
@@ -33,13 +35,13 @@ func TestMakeValidateJWT(t *testing.T) {
 
 	for i, c := range cases {
 		t.Run(fmt.Sprintf("Test case: %v", i), func(t *testing.T) {
-			jwt, err := MakeJWT(c.UserID, c.TokenSecret, c.ExpiresIn)
+			jwt, err := MakeJWT(c.UserID, RoleUser, testKeyring(c.TokenSecret), "chirpy-test", c.ExpiresIn)
 			if err != nil {
 				t.Errorf("MakeJWT failed with: %v", err)
 				return
 			}
 
-			id, err := ValidateJWT(jwt, c.TokenSecret)
+			id, err := ValidateJWT(jwt, testKeyring(c.TokenSecret), ValidationOptions{})
 			if err != nil {
 				t.Errorf("ValidateJWT failed with: %v", err)
 				return
@@ -78,7 +80,7 @@ func TestMakeValidateJWTExpired(t *testing.T) {
 
 	for i, c := range cases {
 		t.Run(fmt.Sprintf("Test case: %v", i), func(t *testing.T) {
-			jwt, err := MakeJWT(c.UserID, c.TokenSecret, c.ExpiresIn)
+			jwt, err := MakeJWT(c.UserID, RoleUser, testKeyring(c.TokenSecret), "chirpy-test", c.ExpiresIn)
 			if err != nil {
 				t.Errorf("MakeJWT failed with: %v", err)
 				return
@@ -86,7 +88,7 @@ func TestMakeValidateJWTExpired(t *testing.T) {
 
 			time.Sleep(sleepTime)
 
-			_, err = ValidateJWT(jwt, c.TokenSecret)
+			_, err = ValidateJWT(jwt, testKeyring(c.TokenSecret), ValidationOptions{})
 			if err == nil {
 				t.Errorf("ValidateJWT succeeded after it should have been expired")
 				return
@@ -94,3 +96,167 @@ func TestMakeValidateJWTExpired(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateJWTClaims(t *testing.T) {
+	userID := uuid.New()
+	jwt, err := MakeJWT(userID, RoleModerator, testKeyring("superSecret"), "chirpy-test", time.Duration(60*time.Second))
+	if err != nil {
+		t.Errorf("MakeJWT failed with: %v", err)
+		return
+	}
+
+	claims, err := ValidateJWTClaims(jwt, testKeyring("superSecret"), ValidationOptions{})
+	if err != nil {
+		t.Errorf("ValidateJWTClaims failed with: %v", err)
+		return
+	}
+	if claims.UserID != userID {
+		t.Errorf("IDs don't match: %v != %v", claims.UserID, userID)
+		return
+	}
+	if claims.Role != RoleModerator {
+		t.Errorf("roles don't match: %v != %v", claims.Role, RoleModerator)
+		return
+	}
+	if claims.ID == "" {
+		t.Errorf("token has no jti")
+		return
+	}
+}
+
+func TestValidateJWTStrict(t *testing.T) {
+	keys := testKeyring("superSecret")
+	userID := uuid.New()
+	sign := func(method jwt.SigningMethod, key any, claims jwt.RegisteredClaims) string {
+		token := jwt.NewWithClaims(method, Claims{Role: RoleUser, RegisteredClaims: claims})
+		token.Header["kid"] = "test"
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("failed signing token: %v", err)
+		}
+		return signed
+	}
+	claims := func(issuer, audience string, expiresIn time.Duration) jwt.RegisteredClaims {
+		return jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Audience:  jwt.ClaimStrings{audience},
+			Subject:   userID.String(),
+			IssuedAt:  jwt.NewNumericDate(time.Now().Add(-time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+		}
+	}
+	secret := []byte("superSecret")
+
+	cases := []struct {
+		Token    string
+		Leeway   time.Duration
+		Expected error
+	}{
+		{
+			Token:    sign(jwt.SigningMethodHS256, secret, claims(Issuer, "chirpy-api", time.Minute)),
+			Expected: nil,
+		},
+		{
+			Token:    sign(jwt.SigningMethodHS256, secret, claims("someone-else", "chirpy-api", time.Minute)),
+			Expected: ErrTokenClaimsInvalid,
+		},
+		{
+			Token:    sign(jwt.SigningMethodHS256, secret, claims(Issuer, "other-api", time.Minute)),
+			Expected: ErrTokenClaimsInvalid,
+		},
+		{
+			Token:    sign(jwt.SigningMethodHS256, secret, claims(Issuer, "chirpy-api", -time.Minute)),
+			Expected: ErrTokenExpired,
+		},
+		{
+			Token:    sign(jwt.SigningMethodHS256, secret, claims(Issuer, "chirpy-api", -time.Minute)),
+			Leeway:   2 * time.Minute,
+			Expected: nil,
+		},
+		{
+			Token:    sign(jwt.SigningMethodHS256, []byte("wrongSecret"), claims(Issuer, "chirpy-api", time.Minute)),
+			Expected: ErrTokenSignatureInvalid,
+		},
+		{
+			Token:    sign(jwt.SigningMethodHS512, secret, claims(Issuer, "chirpy-api", time.Minute)),
+			Expected: ErrTokenSignatureInvalid,
+		},
+		{
+			Token:    sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, claims(Issuer, "chirpy-api", time.Minute)),
+			Expected: ErrTokenSignatureInvalid,
+		},
+		{
+			Token:    "not.a.token",
+			Expected: ErrTokenMalformed,
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", i), func(t *testing.T) {
+			_, err := ValidateJWT(c.Token, keys, ValidationOptions{Audience: "chirpy-api", Leeway: c.Leeway})
+			if c.Expected == nil && err != nil {
+				t.Errorf("ValidateJWT failed with: %v", err)
+				return
+			}
+			if !errors.Is(err, c.Expected) {
+				t.Errorf("ValidateJWT returned %v, expected %v", err, c.Expected)
+				return
+			}
+		})
+	}
+}
+
+func TestHasRole(t *testing.T) {
+	cases := []struct {
+		Role     string
+		Required string
+		Expected bool
+	}{
+		{Role: RoleAdmin, Required: RoleModerator, Expected: true},
+		{Role: RoleModerator, Required: RoleModerator, Expected: true},
+		{Role: RoleUser, Required: RoleModerator, Expected: false},
+		{Role: RoleModerator, Required: RoleAdmin, Expected: false},
+		{Role: "", Required: RoleUser, Expected: false},
+		{Role: "superuser", Required: RoleUser, Expected: false},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", i), func(t *testing.T) {
+			if actual := HasRole(c.Role, c.Required); actual != c.Expected {
+				t.Errorf("HasRole(%q, %q) = %v, expected %v", c.Role, c.Required, actual, c.Expected)
+				return
+			}
+		})
+	}
+}
+
+func TestRefreshTokenHash(t *testing.T) {
+	token, err := MakeRefreshToken()
+	if err != nil {
+		t.Errorf("MakeRefreshToken failed with: %v", err)
+		return
+	}
+	other, err := MakeRefreshToken()
+	if err != nil {
+		t.Errorf("MakeRefreshToken failed with: %v", err)
+		return
+	}
+
+	hash := HashRefreshToken(token)
+	if hash == token || len(hash) != 64 {
+		t.Errorf("unexpected hash: %v", hash)
+		return
+	}
+	if !CheckRefreshTokenHash(hash, token) {
+		t.Errorf("CheckRefreshTokenHash rejected the matching token")
+		return
+	}
+	if CheckRefreshTokenHash(hash, other) {
+		t.Errorf("CheckRefreshTokenHash accepted a different token")
+		return
+	}
+	if prefix := RefreshTokenPrefix(token); len(prefix) != 16 || prefix != token[:16] {
+		t.Errorf("unexpected prefix: %v", prefix)
+		return
+	}
+}
@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// DataExportAudience is the audience of the tokens in data export download
+// links.
+const DataExportAudience = "chirpy-data-export"
+
+// MakeDownloadToken signs a token that lets whoever holds it download the
+// user's data export until it expires, without logging in.
+func MakeDownloadToken(userID, exportID uuid.UUID, keys *Keyring, expiresIn time.Duration) (string, error) {
+	return signJWT(Claims{
+		RegisteredClaims: jwt.RegisteredClaims{ID: exportID.String()},
+	}, userID, keys, DataExportAudience, expiresIn)
+}
+
+// ValidateDownloadToken returns the user and export a token from
+// MakeDownloadToken was made for.
+func ValidateDownloadToken(token string, keys *Keyring) (uuid.UUID, uuid.UUID, error) {
+	claims, err := ValidateJWTClaims(token, keys, ValidationOptions{Audience: DataExportAudience})
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+	exportID, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("%w: export ID parsing failed with: %v", ErrTokenClaimsInvalid, err)
+	}
+	return claims.UserID, exportID, nil
+}
@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestDownloadToken(t *testing.T) {
+	keys := testKeyring("04234")
+	userID, exportID := uuid.New(), uuid.New()
+
+	token, err := MakeDownloadToken(userID, exportID, keys, time.Hour)
+	if err != nil {
+		t.Errorf("MakeDownloadToken failed with: %v", err)
+		return
+	}
+	actualUserID, actualExportID, err := ValidateDownloadToken(token, keys)
+	if err != nil {
+		t.Errorf("ValidateDownloadToken failed with: %v", err)
+		return
+	}
+	if actualUserID != userID || actualExportID != exportID {
+		t.Errorf("ValidateDownloadToken = %v, %v, expected %v, %v", actualUserID, actualExportID, userID, exportID)
+		return
+	}
+
+	if _, err := ValidateJWT(token, keys, ValidationOptions{Audience: "chirpy-api"}); !errors.Is(err, ErrTokenClaimsInvalid) {
+		t.Errorf("a download token was accepted as an access token: %v", err)
+		return
+	}
+	expired, err := MakeDownloadToken(userID, exportID, keys, -time.Minute)
+	if err != nil {
+		t.Errorf("MakeDownloadToken failed with: %v", err)
+		return
+	}
+	if _, _, err := ValidateDownloadToken(expired, keys); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("an expired download token was accepted: %v", err)
+		return
+	}
+}
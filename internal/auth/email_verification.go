@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Audiences of the tokens mailed to users. Access tokens have a different
+// one, and each kind of mailed token only passes validation as that kind.
+const (
+	EmailVerificationAudience = "chirpy-email-verification"
+	EmailChangeAudience       = "chirpy-email-change"
+)
+
+// MakeEmailVerificationToken signs a token proving that whoever holds it
+// received mail sent to email.
+func MakeEmailVerificationToken(userID uuid.UUID, email string, keys *Keyring, expiresIn time.Duration) (string, error) {
+	return signJWT(Claims{Email: email}, userID, keys, EmailVerificationAudience, expiresIn)
+}
+
+// ValidateEmailVerificationToken returns the user and the address a token
+// from MakeEmailVerificationToken was made for.
+func ValidateEmailVerificationToken(token string, keys *Keyring) (uuid.UUID, string, error) {
+	return validateEmailToken(token, keys, EmailVerificationAudience)
+}
+
+// MakeEmailChangeToken signs a token, mailed to newEmail, that confirms the
+// user's request to switch to that address.
+func MakeEmailChangeToken(userID uuid.UUID, newEmail string, keys *Keyring, expiresIn time.Duration) (string, error) {
+	return signJWT(Claims{Email: newEmail}, userID, keys, EmailChangeAudience, expiresIn)
+}
+
+// ValidateEmailChangeToken returns the user and the new address a token
+// from MakeEmailChangeToken was made for.
+func ValidateEmailChangeToken(token string, keys *Keyring) (uuid.UUID, string, error) {
+	return validateEmailToken(token, keys, EmailChangeAudience)
+}
+
+func validateEmailToken(token string, keys *Keyring, audience string) (uuid.UUID, string, error) {
+	claims, err := ValidateJWTClaims(token, keys, ValidationOptions{Audience: audience})
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+	if claims.Email == "" {
+		return uuid.Nil, "", fmt.Errorf("%w: missing email", ErrTokenClaimsInvalid)
+	}
+	return claims.UserID, claims.Email, nil
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestEmailVerificationToken(t *testing.T) {
+	keys := testKeyring("04234")
+	userID := uuid.New()
+
+	token, err := MakeEmailVerificationToken(userID, "walt@breakingbad.com", keys, time.Hour)
+	if err != nil {
+		t.Errorf("MakeEmailVerificationToken failed with: %v", err)
+		return
+	}
+	actualID, email, err := ValidateEmailVerificationToken(token, keys)
+	if err != nil {
+		t.Errorf("ValidateEmailVerificationToken failed with: %v", err)
+		return
+	}
+	if actualID != userID || email != "walt@breakingbad.com" {
+		t.Errorf("ValidateEmailVerificationToken = %v, %v", actualID, email)
+		return
+	}
+
+	if _, err := ValidateJWT(token, keys, ValidationOptions{Audience: "chirpy-api"}); !errors.Is(err, ErrTokenClaimsInvalid) {
+		t.Errorf("a verification token was accepted as an access token: %v", err)
+		return
+	}
+	accessToken, err := MakeJWT(userID, RoleUser, keys, "chirpy-api", time.Hour)
+	if err != nil {
+		t.Errorf("MakeJWT failed with: %v", err)
+		return
+	}
+	if _, _, err := ValidateEmailVerificationToken(accessToken, keys); !errors.Is(err, ErrTokenClaimsInvalid) {
+		t.Errorf("an access token was accepted as a verification token: %v", err)
+		return
+	}
+
+	expired, err := MakeEmailVerificationToken(userID, "walt@breakingbad.com", keys, -time.Minute)
+	if err != nil {
+		t.Errorf("MakeEmailVerificationToken failed with: %v", err)
+		return
+	}
+	if _, _, err := ValidateEmailVerificationToken(expired, keys); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("an expired verification token was accepted: %v", err)
+		return
+	}
+
+	changeToken, err := MakeEmailChangeToken(userID, "heisenberg@breakingbad.com", keys, time.Hour)
+	if err != nil {
+		t.Errorf("MakeEmailChangeToken failed with: %v", err)
+		return
+	}
+	if _, _, err := ValidateEmailVerificationToken(changeToken, keys); !errors.Is(err, ErrTokenClaimsInvalid) {
+		t.Errorf("an email change token was accepted as a verification token: %v", err)
+		return
+	}
+	actualID, email, err = ValidateEmailChangeToken(changeToken, keys)
+	if err != nil || actualID != userID || email != "heisenberg@breakingbad.com" {
+		t.Errorf("ValidateEmailChangeToken = %v, %v, %v", actualID, email, err)
+		return
+	}
+}
@@ -0,0 +1,255 @@
+package auth
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmEdDSA = "EdDSA"
+	AlgorithmRS256 = "RS256"
+)
+
+// SigningKey is either an HMAC secret or, for EdDSA and RS256, a private key
+// whose public half can be published. An empty Algorithm means HS256.
+type SigningKey struct {
+	ID         string
+	Algorithm  string
+	Secret     []byte
+	PrivateKey crypto.Signer
+}
+
+func (key SigningKey) algorithm() string {
+	if key.Algorithm == "" {
+		return AlgorithmHS256
+	}
+	return key.Algorithm
+}
+
+func (key SigningKey) validate() error {
+	if key.ID == "" {
+		return fmt.Errorf("signing key without an ID")
+	}
+	switch key.algorithm() {
+	case AlgorithmHS256:
+		if len(key.Secret) == 0 {
+			return fmt.Errorf("signing key %v has no secret", key.ID)
+		}
+	case AlgorithmEdDSA:
+		if _, ok := key.PrivateKey.(ed25519.PrivateKey); !ok {
+			return fmt.Errorf("signing key %v is not an Ed25519 key", key.ID)
+		}
+	case AlgorithmRS256:
+		if _, ok := key.PrivateKey.(*rsa.PrivateKey); !ok {
+			return fmt.Errorf("signing key %v is not an RSA key", key.ID)
+		}
+	default:
+		return fmt.Errorf("signing key %v has unsupported algorithm %v", key.ID, key.Algorithm)
+	}
+	return nil
+}
+
+func (key SigningKey) method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(key.algorithm())
+}
+
+func (key SigningKey) signingKey() any {
+	if key.algorithm() == AlgorithmHS256 {
+		return key.Secret
+	}
+	return key.PrivateKey
+}
+
+func (key SigningKey) verificationKey() any {
+	if key.algorithm() == AlgorithmHS256 {
+		return key.Secret
+	}
+	return key.PrivateKey.Public()
+}
+
+// Keyring holds the keys access tokens are signed with. The active key signs
+// new tokens, the others are only kept to verify tokens issued before a
+// rotation. It is safe for concurrent use.
+type Keyring struct {
+	mu     sync.RWMutex
+	active string
+	keys   map[string]SigningKey
+	order  []string
+}
+
+func NewKeyring(keys []SigningKey) (*Keyring, error) {
+	k := &Keyring{}
+	if err := k.SetKeys(keys); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// SetKeys replaces the keys of the keyring. The first key becomes the active
+// one.
+func (k *Keyring) SetKeys(keys []SigningKey) error {
+	if len(keys) == 0 {
+		return fmt.Errorf("no signing keys")
+	}
+	byID := make(map[string]SigningKey, len(keys))
+	order := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if err := key.validate(); err != nil {
+			return err
+		}
+		if _, ok := byID[key.ID]; ok {
+			return fmt.Errorf("duplicate signing key %v", key.ID)
+		}
+		byID[key.ID] = key
+		order = append(order, key.ID)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.active = keys[0].ID
+	k.keys = byID
+	k.order = order
+	return nil
+}
+
+// ActiveKey returns the key new tokens are signed with.
+func (k *Keyring) ActiveKey() SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.keys[k.active]
+}
+
+func (k *Keyring) Key(id string) (SigningKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[id]
+	return key, ok
+}
+
+// JWK is a public key in the JSON Web Key format of RFC 7517.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public halves of the asymmetric keys, active key first.
+// HMAC secrets are never published.
+func (k *Keyring) JWKS() JWKS {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	jwks := JWKS{Keys: []JWK{}}
+	for _, id := range k.order {
+		key := k.keys[id]
+		jwk := JWK{KeyID: key.ID, Algorithm: key.algorithm(), Use: "sig"}
+		switch public := key.verificationKey().(type) {
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		default:
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks
+}
+
+// ParsePrivateKeyPEM parses a PEM encoded PKCS #8 Ed25519 or RSA private key,
+// or a PKCS #1 RSA private key.
+func ParsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+// LoadKeyFile reads signing keys from a file, the active key first. Each line
+// is either `<kid> <secret>` for an HS256 key or `<kid> <EdDSA|RS256>
+// <pem-file>` for an asymmetric key, with relative PEM paths resolved
+// against the key file's directory. Empty lines and lines starting with #
+// are skipped.
+func LoadKeyFile(path string) ([]SigningKey, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed opening key file: %v", err)
+	}
+	defer file.Close()
+
+	keys := []SigningKey{}
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		switch len(fields) {
+		case 2:
+			keys = append(keys, SigningKey{ID: fields[0], Secret: []byte(fields[1])})
+		case 3:
+			if fields[1] != AlgorithmEdDSA && fields[1] != AlgorithmRS256 {
+				return nil, fmt.Errorf("line %d: unsupported algorithm %v", lineNumber, fields[1])
+			}
+			pemPath := fields[2]
+			if !filepath.IsAbs(pemPath) {
+				pemPath = filepath.Join(filepath.Dir(path), pemPath)
+			}
+			data, err := os.ReadFile(pemPath)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: failed reading private key: %v", lineNumber, err)
+			}
+			privateKey, err := ParsePrivateKeyPEM(data)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: failed parsing private key: %v", lineNumber, err)
+			}
+			keys = append(keys, SigningKey{ID: fields[0], Algorithm: fields[1], PrivateKey: privateKey})
+		default:
+			return nil, fmt.Errorf("line %d: expected `<kid> <secret>` or `<kid> <algorithm> <pem-file>`", lineNumber)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed reading key file: %v", err)
+	}
+	return keys, nil
+}
@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func testKeyring(secret string) *Keyring {
+	return testKeyringWithID("test", secret)
+}
+
+func testKeyringWithID(id, secret string) *Keyring {
+	keys, err := NewKeyring([]SigningKey{{ID: id, Secret: []byte(secret)}})
+	if err != nil {
+		panic(err)
+	}
+	return keys
+}
+
+func TestKeyRotation(t *testing.T) {
+	userID := uuid.New()
+	keys, err := NewKeyring([]SigningKey{{ID: "2024", Secret: []byte("oldSecret")}})
+	if err != nil {
+		t.Errorf("NewKeyring failed with: %v", err)
+		return
+	}
+	oldJWT, err := MakeJWT(userID, RoleUser, keys, "chirpy-test", time.Duration(60*time.Second))
+	if err != nil {
+		t.Errorf("MakeJWT failed with: %v", err)
+		return
+	}
+
+	if err := keys.SetKeys([]SigningKey{
+		{ID: "2025", Secret: []byte("newSecret")},
+		{ID: "2024", Secret: []byte("oldSecret")},
+	}); err != nil {
+		t.Errorf("SetKeys failed with: %v", err)
+		return
+	}
+	newJWT, err := MakeJWT(userID, RoleUser, keys, "chirpy-test", time.Duration(60*time.Second))
+	if err != nil {
+		t.Errorf("MakeJWT failed with: %v", err)
+		return
+	}
+	for _, jwt := range []string{oldJWT, newJWT} {
+		if _, err := ValidateJWT(jwt, keys, ValidationOptions{}); err != nil {
+			t.Errorf("ValidateJWT failed with: %v", err)
+			return
+		}
+	}
+
+	if err := keys.SetKeys([]SigningKey{{ID: "2025", Secret: []byte("newSecret")}}); err != nil {
+		t.Errorf("SetKeys failed with: %v", err)
+		return
+	}
+	if _, err := ValidateJWT(oldJWT, keys, ValidationOptions{}); err == nil {
+		t.Errorf("ValidateJWT accepted a token signed with a retired key")
+		return
+	}
+	if _, err := ValidateJWT(newJWT, keys, ValidationOptions{}); err != nil {
+		t.Errorf("ValidateJWT failed with: %v", err)
+		return
+	}
+}
+
+func TestLoadKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.txt")
+	content := "# active key first\n2025 newSecret\n\n  2024   oldSecret  \n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed writing key file: %v", err)
+	}
+
+	keys, err := LoadKeyFile(path)
+	if err != nil {
+		t.Errorf("LoadKeyFile failed with: %v", err)
+		return
+	}
+	if len(keys) != 2 || keys[0].ID != "2025" || string(keys[1].Secret) != "oldSecret" {
+		t.Errorf("unexpected keys: %v", keys)
+		return
+	}
+
+	if _, err := NewKeyring([]SigningKey{{ID: "a", Secret: []byte("x")}, {ID: "a", Secret: []byte("y")}}); err == nil {
+		t.Errorf("NewKeyring accepted duplicate key IDs")
+		return
+	}
+}
+
+func TestAsymmetricKeys(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed generating Ed25519 key: %v", err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed generating RSA key: %v", err)
+	}
+
+	cases := []SigningKey{
+		{ID: "ed", Algorithm: AlgorithmEdDSA, PrivateKey: edKey},
+		{ID: "rsa", Algorithm: AlgorithmRS256, PrivateKey: rsaKey},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", i), func(t *testing.T) {
+			keys, err := NewKeyring([]SigningKey{c, {ID: "hmac", Secret: []byte("superSecret")}})
+			if err != nil {
+				t.Errorf("NewKeyring failed with: %v", err)
+				return
+			}
+			userID := uuid.New()
+			jwt, err := MakeJWT(userID, RoleUser, keys, "chirpy-test", time.Duration(60*time.Second))
+			if err != nil {
+				t.Errorf("MakeJWT failed with: %v", err)
+				return
+			}
+			id, err := ValidateJWT(jwt, keys, ValidationOptions{})
+			if err != nil {
+				t.Errorf("ValidateJWT failed with: %v", err)
+				return
+			}
+			if id != userID {
+				t.Errorf("IDs don't match: %v != %v", id, userID)
+				return
+			}
+
+			jwks := keys.JWKS()
+			if len(jwks.Keys) != 1 || jwks.Keys[0].KeyID != c.ID || jwks.Keys[0].Algorithm != c.Algorithm {
+				t.Errorf("unexpected JWKS: %+v", jwks)
+				return
+			}
+		})
+	}
+}
+
+func TestAlgorithmMismatch(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed generating Ed25519 key: %v", err)
+	}
+	keys, err := NewKeyring([]SigningKey{{ID: "shared", Algorithm: AlgorithmEdDSA, PrivateKey: edKey}})
+	if err != nil {
+		t.Errorf("NewKeyring failed with: %v", err)
+		return
+	}
+
+	// An HS256 token using the published public key as its secret must not
+	// pass for one signed by the Ed25519 key.
+	forged, err := MakeJWT(uuid.New(), RoleAdmin, testKeyringWithID("shared", string(edKey.Public().(ed25519.PublicKey))), "chirpy-test", time.Duration(60*time.Second))
+	if err != nil {
+		t.Errorf("MakeJWT failed with: %v", err)
+		return
+	}
+	if _, err := ValidateJWT(forged, keys, ValidationOptions{}); err == nil {
+		t.Errorf("ValidateJWT accepted a token with the wrong algorithm")
+		return
+	}
+}
+
+func TestLoadAsymmetricKeyFile(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed generating Ed25519 key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatalf("failed marshalling key: %v", err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "ed.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("failed writing key: %v", err)
+	}
+	path := filepath.Join(dir, "keys.txt")
+	if err := os.WriteFile(path, []byte("2025 EdDSA ed.pem\n2024 oldSecret\n"), 0o600); err != nil {
+		t.Fatalf("failed writing key file: %v", err)
+	}
+
+	keys, err := LoadKeyFile(path)
+	if err != nil {
+		t.Errorf("LoadKeyFile failed with: %v", err)
+		return
+	}
+	if len(keys) != 2 || keys[0].Algorithm != AlgorithmEdDSA || !edKey.Equal(keys[0].PrivateKey) {
+		t.Errorf("unexpected keys: %v", keys)
+		return
+	}
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrPasswordMismatch = errors.New("password doesn't match")
+
+const (
+	argon2idPrefix     = "$argon2id$"
+	passwordSaltLength = 16
+	passwordKeyLength  = 32
+)
+
+// PasswordParams are the argon2id costs used for new password hashes. Memory
+// is in KiB.
+type PasswordParams struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// DefaultPasswordParams follow the OWASP recommendation for argon2id.
+var DefaultPasswordParams = PasswordParams{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+}
+
+var passwordParams = DefaultPasswordParams
+
+// SetPasswordParams changes the costs used by HashPassword. Existing hashes
+// with other costs are reported by PasswordNeedsRehash.
+func SetPasswordParams(params PasswordParams) error {
+	if params.Memory < 8*uint32(params.Parallelism) || params.Iterations < 1 || params.Parallelism < 1 {
+		return fmt.Errorf("invalid password hash parameters %v", params)
+	}
+	passwordParams = params
+	return nil
+}
+
+func (p PasswordParams) String() string {
+	return fmt.Sprintf("m=%d,t=%d,p=%d", p.Memory, p.Iterations, p.Parallelism)
+}
+
+// ParsePasswordParams reads parameters in the "m=65536,t=3,p=2" form used
+// inside argon2id hashes.
+func ParsePasswordParams(s string) (PasswordParams, error) {
+	params := PasswordParams{}
+	if _, err := fmt.Sscanf(s, "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return PasswordParams{}, fmt.Errorf("invalid password hash parameters %q: %v", s, err)
+	}
+	return params, nil
+}
+
+// HashPassword hashes password with argon2id, encoding the parameters and
+// salt in the PHC string format.
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, passwordSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to make a salt: %v", err)
+	}
+	params := passwordParams
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, passwordKeyLength)
+	return fmt.Sprintf("%sv=%d$%v$%s$%s",
+		argon2idPrefix,
+		argon2.Version,
+		params,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+type argon2idHash struct {
+	params PasswordParams
+	salt   []byte
+	key    []byte
+}
+
+func parseArgon2idHash(hash string) (argon2idHash, error) {
+	// "", "argon2id", "v=19", "m=65536,t=3,p=2", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return argon2idHash{}, errors.New("malformed argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return argon2idHash{}, fmt.Errorf("unsupported argon2id version %q", parts[2])
+	}
+	params, err := ParsePasswordParams(parts[3])
+	if err != nil {
+		return argon2idHash{}, err
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return argon2idHash{}, fmt.Errorf("malformed argon2id salt: %v", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return argon2idHash{}, fmt.Errorf("malformed argon2id key: %v", err)
+	}
+	return argon2idHash{params: params, salt: salt, key: key}, nil
+}
+
+// CheckPasswordHash returns ErrPasswordMismatch if password doesn't match
+// hash. Besides argon2id it still accepts the bcrypt hashes of older
+// accounts.
+func CheckPasswordHash(hash, password string) error {
+	if !strings.HasPrefix(hash, argon2idPrefix) {
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrPasswordMismatch
+		}
+		return err
+	}
+
+	parsed, err := parseArgon2idHash(hash)
+	if err != nil {
+		return err
+	}
+	key := argon2.IDKey([]byte(password), parsed.salt, parsed.params.Iterations, parsed.params.Memory, parsed.params.Parallelism, uint32(len(parsed.key)))
+	if subtle.ConstantTimeCompare(key, parsed.key) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+// PasswordNeedsRehash reports whether hash was made with another algorithm
+// or other costs than HashPassword currently uses. It should be replaced
+// after the next successful CheckPasswordHash.
+func PasswordNeedsRehash(hash string) bool {
+	if !strings.HasPrefix(hash, argon2idPrefix) {
+		return true
+	}
+	parsed, err := parseArgon2idHash(hash)
+	if err != nil {
+		return true
+	}
+	return parsed.params != passwordParams || len(parsed.salt) != passwordSaltLength || len(parsed.key) != passwordKeyLength
+}
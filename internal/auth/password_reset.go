@@ -0,0 +1,25 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// MakePasswordResetToken returns a single-use token mailed to users who
+// forgot their password.
+func MakePasswordResetToken() (string, error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", fmt.Errorf("failed to make a password reset token: %v", err)
+	}
+	return hex.EncodeToString(tokenBytes), nil
+}
+
+// HashPasswordResetToken returns the hex SHA-256 of a reset token, which is
+// what gets stored instead of the token itself.
+func HashPasswordResetToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
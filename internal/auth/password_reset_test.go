@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"testing"
+)
+
+func TestPasswordResetToken(t *testing.T) {
+	token, err := MakePasswordResetToken()
+	if err != nil {
+		t.Errorf("MakePasswordResetToken failed with: %v", err)
+		return
+	}
+	other, err := MakePasswordResetToken()
+	if err != nil {
+		t.Errorf("MakePasswordResetToken failed with: %v", err)
+		return
+	}
+	if len(token) != 64 || token == other {
+		t.Errorf("unexpected tokens %q and %q", token, other)
+		return
+	}
+	hash := HashPasswordResetToken(token)
+	if hash == token || hash != HashPasswordResetToken(token) || hash == HashPasswordResetToken(other) {
+		t.Errorf("unexpected hash %q of %q", hash, token)
+		return
+	}
+}
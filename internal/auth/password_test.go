@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestCheckPasswordHash(t *testing.T) {
+	argon2idHash, err := HashPassword("04234")
+	if err != nil {
+		t.Errorf("HashPassword failed with: %v", err)
+		return
+	}
+	if !strings.HasPrefix(argon2idHash, "$argon2id$v=19$m=65536,t=3,p=2$") {
+		t.Errorf("unexpected hash format: %v", argon2idHash)
+		return
+	}
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("04234"), bcrypt.MinCost)
+	if err != nil {
+		t.Errorf("bcrypt failed with: %v", err)
+		return
+	}
+
+	cases := []struct {
+		Hash     string
+		Password string
+		Expected error
+	}{
+		{Hash: argon2idHash, Password: "04234", Expected: nil},
+		{Hash: argon2idHash, Password: "04235", Expected: ErrPasswordMismatch},
+		{Hash: argon2idHash, Password: "", Expected: ErrPasswordMismatch},
+		{Hash: string(bcryptHash), Password: "04234", Expected: nil},
+		{Hash: string(bcryptHash), Password: "04235", Expected: ErrPasswordMismatch},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", i), func(t *testing.T) {
+			err := CheckPasswordHash(c.Hash, c.Password)
+			if !errors.Is(err, c.Expected) {
+				t.Errorf("CheckPasswordHash returned %v, expected %v", err, c.Expected)
+				return
+			}
+		})
+	}
+
+	if err := CheckPasswordHash("$argon2id$v=19$m=65536$salt$key", "04234"); err == nil || errors.Is(err, ErrPasswordMismatch) {
+		t.Errorf("CheckPasswordHash accepted a malformed hash: %v", err)
+		return
+	}
+}
+
+func TestPasswordNeedsRehash(t *testing.T) {
+	defer SetPasswordParams(DefaultPasswordParams)
+
+	current, err := HashPassword("04234")
+	if err != nil {
+		t.Errorf("HashPassword failed with: %v", err)
+		return
+	}
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("04234"), bcrypt.MinCost)
+	if err != nil {
+		t.Errorf("bcrypt failed with: %v", err)
+		return
+	}
+	if PasswordNeedsRehash(current) {
+		t.Errorf("PasswordNeedsRehash wants to replace a current hash")
+		return
+	}
+	if !PasswordNeedsRehash(string(bcryptHash)) {
+		t.Errorf("PasswordNeedsRehash keeps a bcrypt hash")
+		return
+	}
+
+	stronger, err := ParsePasswordParams("m=65536,t=4,p=2")
+	if err != nil {
+		t.Errorf("ParsePasswordParams failed with: %v", err)
+		return
+	}
+	if err := SetPasswordParams(stronger); err != nil {
+		t.Errorf("SetPasswordParams failed with: %v", err)
+		return
+	}
+	if !PasswordNeedsRehash(current) {
+		t.Errorf("PasswordNeedsRehash keeps a hash with outdated costs")
+		return
+	}
+	if err := CheckPasswordHash(current, "04234"); err != nil {
+		t.Errorf("CheckPasswordHash rejects a hash with outdated costs: %v", err)
+		return
+	}
+}
+
+func TestParsePasswordParams(t *testing.T) {
+	cases := []struct {
+		Params   string
+		Expected PasswordParams
+		WantErr  bool
+	}{
+		{Params: "m=65536,t=3,p=2", Expected: DefaultPasswordParams},
+		{Params: "m=19456,t=2,p=1", Expected: PasswordParams{Memory: 19456, Iterations: 2, Parallelism: 1}},
+		{Params: "t=3,p=2", WantErr: true},
+		{Params: "", WantErr: true},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", i), func(t *testing.T) {
+			actual, err := ParsePasswordParams(c.Params)
+			if (err != nil) != c.WantErr {
+				t.Errorf("ParsePasswordParams(%q) returned error %v", c.Params, err)
+				return
+			}
+			if actual != c.Expected {
+				t.Errorf("ParsePasswordParams(%q) = %v, expected %v", c.Params, actual, c.Expected)
+				return
+			}
+		})
+	}
+
+	if err := SetPasswordParams(PasswordParams{Memory: 64, Iterations: 0, Parallelism: 1}); err == nil {
+		t.Errorf("SetPasswordParams accepted zero iterations")
+		return
+	}
+}
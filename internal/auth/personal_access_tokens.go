@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	ScopeChirpsRead   = "chirps:read"
+	ScopeChirpsWrite  = "chirps:write"
+	ScopeProfileWrite = "profile:write"
+)
+
+var validScopes = []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeProfileWrite}
+
+// ParseScopes validates requested scopes and returns them sorted and without
+// duplicates.
+func ParseScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+	parsed := []string{}
+	for _, scope := range scopes {
+		if !slices.Contains(validScopes, scope) {
+			return nil, fmt.Errorf("unknown scope %q", scope)
+		}
+		if !slices.Contains(parsed, scope) {
+			parsed = append(parsed, scope)
+		}
+	}
+	slices.Sort(parsed)
+	return parsed, nil
+}
+
+// HasScope reports whether scopes grant scope. Nil scopes belong to login
+// sessions, which may do everything.
+func HasScope(scopes []string, scope string) bool {
+	return scopes == nil || slices.Contains(scopes, scope)
+}
+
+// FormatScopes and SplitScopes convert between scopes and the space separated
+// form they are stored in.
+func FormatScopes(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+func SplitScopes(scopes string) []string {
+	return strings.Fields(scopes)
+}
+
+const (
+	personalAccessTokenMarker       = "chirpy_pat_"
+	personalAccessTokenPrefixLength = len(personalAccessTokenMarker) + 8
+)
+
+// MakePersonalAccessToken returns a new random token. The marker at its start
+// tells it apart from JWTs and makes leaked tokens easy to scan for.
+func MakePersonalAccessToken() (string, error) {
+	tokenBytes := make([]byte, 32)
+
+	_, err := rand.Read(tokenBytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to make a personal access token: %v", err)
+	}
+
+	return personalAccessTokenMarker + hex.EncodeToString(tokenBytes), nil
+}
+
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, personalAccessTokenMarker)
+}
+
+func HashPersonalAccessToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// PersonalAccessTokenPrefix returns the non-secret part of a personal access
+// token used to look it up and to show it in token lists.
+func PersonalAccessTokenPrefix(token string) string {
+	if len(token) < personalAccessTokenPrefixLength {
+		return token
+	}
+	return token[:personalAccessTokenPrefixLength]
+}
+
+func CheckPersonalAccessTokenHash(hash, token string) bool {
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(HashPersonalAccessToken(token))) == 1
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestParseScopes(t *testing.T) {
+	cases := []struct {
+		Scopes   []string
+		Expected []string
+		Err      bool
+	}{
+		{
+			Scopes:   []string{ScopeChirpsWrite, ScopeChirpsRead},
+			Expected: []string{ScopeChirpsRead, ScopeChirpsWrite},
+		},
+		{
+			Scopes:   []string{ScopeProfileWrite, ScopeProfileWrite},
+			Expected: []string{ScopeProfileWrite},
+		},
+		{
+			Scopes: []string{ScopeChirpsRead, "admin"},
+			Err:    true,
+		},
+		{
+			Scopes: []string{},
+			Err:    true,
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", i), func(t *testing.T) {
+			actual, err := ParseScopes(c.Scopes)
+			if c.Err {
+				if err == nil {
+					t.Errorf("ParseScopes(%v) succeeded, expected an error", c.Scopes)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("ParseScopes failed with: %v", err)
+				return
+			}
+			if !slices.Equal(actual, c.Expected) {
+				t.Errorf("ParseScopes(%v) = %v, expected %v", c.Scopes, actual, c.Expected)
+				return
+			}
+		})
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	if !HasScope(nil, ScopeChirpsWrite) {
+		t.Errorf("session tokens should have every scope")
+		return
+	}
+	scopes := SplitScopes(FormatScopes([]string{ScopeChirpsRead}))
+	if !HasScope(scopes, ScopeChirpsRead) || HasScope(scopes, ScopeChirpsWrite) {
+		t.Errorf("unexpected scopes: %v", scopes)
+		return
+	}
+}
+
+func TestPersonalAccessToken(t *testing.T) {
+	token, err := MakePersonalAccessToken()
+	if err != nil {
+		t.Errorf("MakePersonalAccessToken failed with: %v", err)
+		return
+	}
+	if !IsPersonalAccessToken(token) {
+		t.Errorf("token %q isn't recognized as a personal access token", token)
+		return
+	}
+	if prefix := PersonalAccessTokenPrefix(token); len(prefix) != personalAccessTokenPrefixLength {
+		t.Errorf("unexpected prefix %q", prefix)
+		return
+	}
+	hash := HashPersonalAccessToken(token)
+	if !CheckPersonalAccessTokenHash(hash, token) {
+		t.Errorf("hash doesn't match its token")
+		return
+	}
+	if CheckPersonalAccessTokenHash(hash, token+"0") {
+		t.Errorf("hash matches a different token")
+		return
+	}
+}
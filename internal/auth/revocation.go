@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RevocationList keeps revoked access tokens in memory until they expire,
+// along with per-user cutoffs before which every issued token is revoked.
+// It is safe for concurrent use.
+type RevocationList struct {
+	mu           sync.RWMutex
+	tokens       map[string]time.Time
+	issuedBefore map[uuid.UUID]time.Time
+}
+
+func NewRevocationList() *RevocationList {
+	return &RevocationList{
+		tokens:       map[string]time.Time{},
+		issuedBefore: map[uuid.UUID]time.Time{},
+	}
+}
+
+func (l *RevocationList) RevokeToken(id string, expiresAt time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for tokenID, tokenExpiresAt := range l.tokens {
+		if tokenExpiresAt.Before(now) {
+			delete(l.tokens, tokenID)
+		}
+	}
+	if expiresAt.After(now) {
+		l.tokens[id] = expiresAt
+	}
+}
+
+// RevokeIssuedBefore revokes every token of the user issued before t. Token
+// issue times only have a precision of seconds, so t is truncated to match.
+func (l *RevocationList) RevokeIssuedBefore(userID uuid.UUID, t time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	t = t.Truncate(time.Second)
+	if t.After(l.issuedBefore[userID]) {
+		l.issuedBefore[userID] = t
+	}
+}
+
+func (l *RevocationList) IsRevoked(claims TokenClaims) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if _, ok := l.tokens[claims.ID]; ok {
+		return true
+	}
+	issuedBefore, ok := l.issuedBefore[claims.UserID]
+	return ok && claims.IssuedAt.Before(issuedBefore)
+}
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRevokeToken(t *testing.T) {
+	revocations := NewRevocationList()
+	userID := uuid.New()
+
+	jwt, err := MakeJWT(userID, RoleUser, testKeyring("superSecret"), "chirpy-test", time.Duration(60*time.Second))
+	if err != nil {
+		t.Errorf("MakeJWT failed with: %v", err)
+		return
+	}
+	claims, err := ValidateJWTClaims(jwt, testKeyring("superSecret"), ValidationOptions{Revocations: revocations})
+	if err != nil {
+		t.Errorf("ValidateJWTClaims failed with: %v", err)
+		return
+	}
+
+	revocations.RevokeToken(claims.ID, claims.ExpiresAt)
+	if _, err := ValidateJWTClaims(jwt, testKeyring("superSecret"), ValidationOptions{Revocations: revocations}); err == nil {
+		t.Errorf("ValidateJWTClaims accepted a revoked token")
+		return
+	}
+}
+
+func TestRevokeIssuedBefore(t *testing.T) {
+	revocations := NewRevocationList()
+	userID := uuid.New()
+
+	jwt, err := MakeJWT(userID, RoleUser, testKeyring("superSecret"), "chirpy-test", time.Duration(60*time.Second))
+	if err != nil {
+		t.Errorf("MakeJWT failed with: %v", err)
+		return
+	}
+
+	revocations.RevokeIssuedBefore(uuid.New(), time.Now().Add(time.Minute))
+	claims, err := ValidateJWTClaims(jwt, testKeyring("superSecret"), ValidationOptions{Revocations: revocations})
+	if err != nil {
+		t.Errorf("revoking another user's tokens revoked this one: %v", err)
+		return
+	}
+
+	revocations.RevokeIssuedBefore(userID, claims.IssuedAt.Add(500*time.Millisecond))
+	if _, err := ValidateJWTClaims(jwt, testKeyring("superSecret"), ValidationOptions{Revocations: revocations}); err != nil {
+		t.Errorf("token issued in the same second as the cutoff was revoked: %v", err)
+		return
+	}
+
+	revocations.RevokeIssuedBefore(userID, time.Now().Add(2*time.Second))
+	if _, err := ValidateJWTClaims(jwt, testKeyring("superSecret"), ValidationOptions{Revocations: revocations}); err == nil {
+		t.Errorf("ValidateJWTClaims accepted a token issued before the cutoff")
+		return
+	}
+}
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	totpDigits = 6
+	totpPeriod = 30
+	// totpSkew is how many periods before and after now are accepted, to
+	// allow for clock drift and slow typing.
+	totpSkew = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a random base32 encoded TOTP secret.
+func GenerateTOTPSecret() (string, error) {
+	secretBytes := make([]byte, 20)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", fmt.Errorf("failed to make a TOTP secret: %v", err)
+	}
+	return totpEncoding.EncodeToString(secretBytes), nil
+}
+
+// TOTPURI returns the otpauth:// URI authenticator apps read from QR codes.
+func TOTPURI(secret, issuer, account string) string {
+	values := url.Values{
+		"secret":    {secret},
+		"issuer":    {issuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(totpDigits)},
+		"period":    {fmt.Sprint(totpPeriod)},
+	}
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	return "otpauth://totp/" + label + "?" + values.Encode()
+}
+
+func totpCounter(t time.Time) int64 {
+	return t.Unix() / totpPeriod
+}
+
+// hotp computes the HOTP value of RFC 4226 with the given number of digits.
+func hotp(key []byte, counter int64, digits int) string {
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	modulo := uint32(1)
+	for range digits {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%modulo)
+}
+
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return nil, fmt.Errorf("invalid TOTP secret: %v", err)
+	}
+	return key, nil
+}
+
+// TOTPCode returns the code for secret at time t.
+func TOTPCode(secret string, t time.Time) (string, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, totpCounter(t), totpDigits), nil
+}
+
+// ValidateTOTP checks code against secret around time t. It returns the time
+// step the code belongs to, which must be stored and passed back as
+// lastCounter so a code can't be used twice.
+func ValidateTOTP(secret, code string, t time.Time, lastCounter int64) (int64, bool) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return 0, false
+	}
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	now := totpCounter(t)
+	for counter := now - totpSkew; counter <= now+totpSkew; counter++ {
+		if counter <= lastCounter {
+			continue
+		}
+		if hmac.Equal([]byte(hotp(key, counter, totpDigits)), []byte(code)) {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// GenerateRecoveryCodes returns n random one-time codes formatted as
+// xxxxx-xxxxx.
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, 0, n)
+	for range n {
+		codeBytes := make([]byte, 7)
+		if _, err := rand.Read(codeBytes); err != nil {
+			return nil, fmt.Errorf("failed to make a recovery code: %v", err)
+		}
+		code := strings.ToLower(totpEncoding.EncodeToString(codeBytes))[:10]
+		codes = append(codes, code[:5]+"-"+code[5:])
+	}
+	return codes, nil
+}
+
+// NormalizeRecoveryCode undoes the formatting users may add or drop when
+// typing a recovery code.
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, " ", "")
+	code = strings.ReplaceAll(code, "-", "")
+	if len(code) != 10 {
+		return code
+	}
+	return code[:5] + "-" + code[5:]
+}
+
+// MakeLoginChallenge returns the token a client trades, together with a
+// second factor, for access and refresh tokens.
+func MakeLoginChallenge() (string, error) {
+	challengeBytes := make([]byte, 32)
+	if _, err := rand.Read(challengeBytes); err != nil {
+		return "", fmt.Errorf("failed to make a login challenge: %v", err)
+	}
+	return hex.EncodeToString(challengeBytes), nil
+}
+
+func HashLoginChallenge(challenge string) string {
+	hash := sha256.Sum256([]byte(challenge))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"encoding/base32"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// Test vectors from RFC 6238 appendix B, truncated to six digits.
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	cases := []struct {
+		Time     int64
+		Expected string
+	}{
+		{Time: 59, Expected: "287082"},
+		{Time: 1111111109, Expected: "081804"},
+		{Time: 1111111111, Expected: "050471"},
+		{Time: 1234567890, Expected: "005924"},
+		{Time: 2000000000, Expected: "279037"},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", i), func(t *testing.T) {
+			actual, err := TOTPCode(secret, time.Unix(c.Time, 0))
+			if err != nil {
+				t.Errorf("TOTPCode failed with: %v", err)
+				return
+			}
+			if actual != c.Expected {
+				t.Errorf("TOTPCode at %v = %v, expected %v", c.Time, actual, c.Expected)
+				return
+			}
+		})
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Errorf("GenerateTOTPSecret failed with: %v", err)
+		return
+	}
+	now := time.Unix(1700000000, 0)
+	code, err := TOTPCode(secret, now)
+	if err != nil {
+		t.Errorf("TOTPCode failed with: %v", err)
+		return
+	}
+
+	counter, ok := ValidateTOTP(secret, code, now.Add(20*time.Second), 0)
+	if !ok {
+		t.Errorf("ValidateTOTP rejected a code from the previous period")
+		return
+	}
+	if _, ok := ValidateTOTP(secret, code, now, counter); ok {
+		t.Errorf("ValidateTOTP accepted a code twice")
+		return
+	}
+	if _, ok := ValidateTOTP(secret, code, now.Add(5*time.Minute), 0); ok {
+		t.Errorf("ValidateTOTP accepted a stale code")
+		return
+	}
+	if _, ok := ValidateTOTP(secret, "12345", now, 0); ok {
+		t.Errorf("ValidateTOTP accepted a short code")
+		return
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("JBSWY3DPEHPK3PXP", "Chirpy", "walt@breakingbad.com")
+	if !strings.HasPrefix(uri, "otpauth://totp/Chirpy:walt@breakingbad.com?") ||
+		!strings.Contains(uri, "secret=JBSWY3DPEHPK3PXP") || !strings.Contains(uri, "issuer=Chirpy") {
+		t.Errorf("unexpected URI: %v", uri)
+		return
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Errorf("GenerateRecoveryCodes failed with: %v", err)
+		return
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' || seen[code] {
+			t.Errorf("unexpected code %q in %v", code, codes)
+			return
+		}
+		seen[code] = true
+		if NormalizeRecoveryCode(" "+strings.ToUpper(strings.ReplaceAll(code, "-", ""))) != code {
+			t.Errorf("NormalizeRecoveryCode doesn't restore %q", code)
+			return
+		}
+	}
+}
@@ -7,29 +7,59 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
 
+const approveHeldChirp = `-- name: ApproveHeldChirp :one
+UPDATE chirps SET updated_at = NOW(), flagged = false
+WHERE id = $1 AND flagged AND NOT hidden
+RETURNING id, created_at, updated_at, body, user_id, flagged, hidden, held_by, hold_reason
+`
+
+func (q *Queries) ApproveHeldChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, approveHeldChirp, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.Flagged,
+		&i.Hidden,
+		&i.HeldBy,
+		&i.HoldReason,
+	)
+	return i, err
+}
+
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, flagged, held_by, hold_reason)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3,
+    $4,
+    $5
 )
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, flagged, hidden, held_by, hold_reason
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body       string
+	UserID     uuid.UUID
+	Flagged    bool
+	HeldBy     sql.NullString
+	HoldReason sql.NullString
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID, arg.Flagged, arg.HeldBy, arg.HoldReason)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -37,6 +67,10 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.Flagged,
+		&i.Hidden,
+		&i.HeldBy,
+		&i.HoldReason,
 	)
 	return i, err
 }
@@ -51,7 +85,7 @@ func (q *Queries) DeleteChirpByID(ctx context.Context, id uuid.UUID) error {
 }
 
 const getAllChirps = `-- name: GetAllChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps ORDER BY created_at
+SELECT id, created_at, updated_at, body, user_id, flagged, hidden, held_by, hold_reason FROM chirps WHERE NOT flagged AND NOT hidden ORDER BY created_at
 `
 
 func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
@@ -69,6 +103,50 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.Flagged,
+			&i.Hidden,
+			&i.HeldBy,
+			&i.HoldReason,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAllChirpsFromActiveUsers = `-- name: GetAllChirpsFromActiveUsers :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.flagged, chirps.hidden, chirps.held_by, chirps.hold_reason FROM chirps JOIN users ON chirps.user_id = users.id
+WHERE NOT chirps.flagged AND NOT chirps.hidden AND NOT users.banned
+AND (users.suspended_until IS NULL OR users.suspended_until < NOW())
+ORDER BY chirps.created_at
+`
+
+func (q *Queries) GetAllChirpsFromActiveUsers(ctx context.Context) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getAllChirpsFromActiveUsers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.Flagged,
+			&i.Hidden,
+			&i.HeldBy,
+			&i.HoldReason,
 		); err != nil {
 			return nil, err
 		}
@@ -84,7 +162,7 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const getChirpByID = `-- name: GetChirpByID :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps WHERE id = $1
+SELECT id, created_at, updated_at, body, user_id, flagged, hidden, held_by, hold_reason FROM chirps WHERE id = $1
 `
 
 func (q *Queries) GetChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error) {
@@ -96,6 +174,139 @@ func (q *Queries) GetChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error)
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.Flagged,
+		&i.Hidden,
+		&i.HeldBy,
+		&i.HoldReason,
+	)
+	return i, err
+}
+
+const getChirpByIDFromActiveUser = `-- name: GetChirpByIDFromActiveUser :one
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.flagged, chirps.hidden, chirps.held_by, chirps.hold_reason FROM chirps JOIN users ON chirps.user_id = users.id
+WHERE chirps.id = $1 AND NOT users.banned
+AND (users.suspended_until IS NULL OR users.suspended_until < NOW())
+`
+
+func (q *Queries) GetChirpByIDFromActiveUser(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpByIDFromActiveUser, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.Flagged,
+		&i.Hidden,
+		&i.HeldBy,
+		&i.HoldReason,
+	)
+	return i, err
+}
+
+const getChirpsByUser = `-- name: GetChirpsByUser :many
+SELECT id, created_at, updated_at, body, user_id, flagged, hidden, held_by, hold_reason FROM chirps WHERE user_id = $1 ORDER BY created_at
+`
+
+func (q *Queries) GetChirpsByUser(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.Flagged,
+			&i.Hidden,
+			&i.HeldBy,
+			&i.HoldReason,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getHeldChirps = `-- name: GetHeldChirps :many
+SELECT id, created_at, updated_at, body, user_id, flagged, hidden, held_by, hold_reason FROM chirps WHERE flagged AND NOT hidden ORDER BY created_at
+`
+
+func (q *Queries) GetHeldChirps(ctx context.Context) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getHeldChirps)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.Flagged,
+			&i.Hidden,
+			&i.HeldBy,
+			&i.HoldReason,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const hideChirpByID = `-- name: HideChirpByID :exec
+UPDATE chirps SET updated_at = NOW(), hidden = true WHERE id = $1
+`
+
+func (q *Queries) HideChirpByID(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, hideChirpByID, id)
+	return err
+}
+
+const rejectHeldChirp = `-- name: RejectHeldChirp :one
+UPDATE chirps SET updated_at = NOW(), hidden = true
+WHERE id = $1 AND flagged AND NOT hidden
+RETURNING id, created_at, updated_at, body, user_id, flagged, hidden, held_by, hold_reason
+`
+
+func (q *Queries) RejectHeldChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, rejectHeldChirp, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.Flagged,
+		&i.Hidden,
+		&i.HeldBy,
+		&i.HoldReason,
 	)
 	return i, err
 }
@@ -12,27 +12,183 @@ import (
 )
 
 type Chirp struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Body       string
+	UserID     uuid.UUID
+	Flagged    bool
+	Hidden     bool
+	HeldBy     sql.NullString
+	HoldReason sql.NullString
+}
+
+type DataExport struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
-	Body      string
 	UserID    uuid.UUID
+	Status    string
+	Archive   []byte
+	ExpiresAt sql.NullTime
 }
 
-type RefreshToken struct {
-	Token     string
+type LoginChallenge struct {
+	TokenHash string
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+	Attempts  int32
+}
+
+type ModerationAction struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	ModeratorID uuid.NullUUID
+	ReportID    uuid.NullUUID
+	Action      string
+	ChirpID     uuid.NullUUID
+	UserID      uuid.NullUUID
+	Note        sql.NullString
+}
+
+type ModerationWord struct {
+	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
+	Word      string
+	Action    string
+	Language  sql.NullString
+}
+
+type OauthAuthorizationCode struct {
+	CodeHash      string
+	CreatedAt     time.Time
+	ClientID      uuid.UUID
+	UserID        uuid.UUID
+	RedirectUri   string
+	Scopes        string
+	CodeChallenge string
+	ExpiresAt     time.Time
+	UsedAt        sql.NullTime
+}
+
+type OauthClient struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	OwnerID      uuid.UUID
+	Name         string
+	SecretHash   sql.NullString
+	RedirectUris string
+	Scopes       string
+}
+
+type PasswordResetToken struct {
+	TokenHash string
+	CreatedAt time.Time
 	UserID    uuid.UUID
 	ExpiresAt time.Time
-	RevokedAt sql.NullTime
+	UsedAt    sql.NullTime
 }
 
-type User struct {
+type PersonalAccessToken struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	UserID      uuid.UUID
+	Name        string
+	TokenHash   string
+	TokenPrefix string
+	Scopes      string
+	ExpiresAt   sql.NullTime
+	LastUsedAt  sql.NullTime
+	RevokedAt   sql.NullTime
+}
+
+type PolkaEvent struct {
+	ID         string
+	ReceivedAt time.Time
+}
+
+type RecoveryCode struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	CodeHash  string
+	UsedAt    sql.NullTime
+}
+
+type RefreshToken struct {
+	TokenHash   string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	UserID      uuid.UUID
+	ExpiresAt   time.Time
+	RevokedAt   sql.NullTime
+	FamilyID    uuid.UUID
+	ReplacedBy  sql.NullString
+	TokenPrefix string
+	UserAgent   string
+	IpAddress   string
+	LastUsedAt  time.Time
+	ClientID    uuid.NullUUID
+	Scopes      sql.NullString
+}
+
+type Report struct {
 	ID             uuid.UUID
 	CreatedAt      time.Time
 	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+	ReporterID     uuid.UUID
+	ChirpID        uuid.NullUUID
+	ReportedUserID uuid.NullUUID
+	Reason         string
+	Details        sql.NullString
+	Status         string
+	ClaimedBy      uuid.NullUUID
+	ClaimedAt      sql.NullTime
+	Resolution     sql.NullString
+	ResolvedAt     sql.NullTime
+}
+
+type RevokedAccessToken struct {
+	Jti       string
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+}
+
+type Subscription struct {
+	ID               uuid.UUID
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	UserID           uuid.UUID
+	Status           string
+	StartedAt        time.Time
+	CurrentPeriodEnd time.Time
+	CancelledAt      sql.NullTime
+	LastEventAt      time.Time
+}
+
+type User struct {
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	Email               string
+	HashedPassword      string
+	IsChirpyRed         bool
+	SuspendedUntil      sql.NullTime
+	Banned              bool
+	Role                string
+	TokensIssuedBefore  sql.NullTime
+	TotpSecret          sql.NullString
+	TotpEnabled         bool
+	TotpLastCounter     int64
+	FailedLoginAttempts int32
+	LastFailedLoginAt   sql.NullTime
+	EmailVerifiedAt     sql.NullTime
+	PendingEmail        sql.NullString
+	DeletionRequestedAt sql.NullTime
+	LoginBlockedUntil   sql.NullTime
 }
@@ -13,6 +13,91 @@ import (
 	"github.com/google/uuid"
 )
 
+const cancelDeletionUserWithID = `-- name: CancelDeletionUserWithID :exec
+UPDATE users SET updated_at = NOW(), deletion_requested_at = NULL WHERE id = $1
+`
+
+func (q *Queries) CancelDeletionUserWithID(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, cancelDeletionUserWithID, id)
+	return err
+}
+
+const claimLoginAttemptUserWithID = `-- name: ClaimLoginAttemptUserWithID :one
+UPDATE users SET failed_login_attempts = failed_login_attempts + 1, last_failed_login_at = NOW(), login_blocked_until = $2
+WHERE id = $1 AND (login_blocked_until IS NULL OR login_blocked_until <= NOW())
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, suspended_until, banned, role, tokens_issued_before, totp_secret, totp_enabled, totp_last_counter, failed_login_attempts, last_failed_login_at, email_verified_at, pending_email, deletion_requested_at, login_blocked_until
+`
+
+type ClaimLoginAttemptUserWithIDParams struct {
+	ID                uuid.UUID
+	LoginBlockedUntil sql.NullTime
+}
+
+func (q *Queries) ClaimLoginAttemptUserWithID(ctx context.Context, arg ClaimLoginAttemptUserWithIDParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, claimLoginAttemptUserWithID, arg.ID, arg.LoginBlockedUntil)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.SuspendedUntil,
+		&i.Banned,
+		&i.Role,
+		&i.TokensIssuedBefore,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastCounter,
+		&i.FailedLoginAttempts,
+		&i.LastFailedLoginAt,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.DeletionRequestedAt,
+		&i.LoginBlockedUntil,
+	)
+	return i, err
+}
+
+const confirmPendingEmailUserWithID = `-- name: ConfirmPendingEmailUserWithID :one
+UPDATE users SET updated_at = NOW(), email = pending_email, pending_email = NULL, email_verified_at = NOW()
+WHERE id = $1 AND pending_email = $2
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, suspended_until, banned, role, tokens_issued_before, totp_secret, totp_enabled, totp_last_counter, failed_login_attempts, last_failed_login_at, email_verified_at, pending_email, deletion_requested_at, login_blocked_until
+`
+
+type ConfirmPendingEmailUserWithIDParams struct {
+	ID           uuid.UUID
+	PendingEmail sql.NullString
+}
+
+func (q *Queries) ConfirmPendingEmailUserWithID(ctx context.Context, arg ConfirmPendingEmailUserWithIDParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, confirmPendingEmailUserWithID, arg.ID, arg.PendingEmail)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.SuspendedUntil,
+		&i.Banned,
+		&i.Role,
+		&i.TokensIssuedBefore,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastCounter,
+		&i.FailedLoginAttempts,
+		&i.LastFailedLoginAt,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.DeletionRequestedAt,
+		&i.LoginBlockedUntil,
+	)
+	return i, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (id, created_at, updated_at, email, hashed_password)
 VALUES (
@@ -22,7 +107,7 @@ VALUES (
     $1,
     $2
 )
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, suspended_until, banned, role, tokens_issued_before, totp_secret, totp_enabled, totp_last_counter, failed_login_attempts, last_failed_login_at, email_verified_at, pending_email, deletion_requested_at, login_blocked_until
 `
 
 type CreateUserParams struct {
@@ -40,6 +125,19 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.SuspendedUntil,
+		&i.Banned,
+		&i.Role,
+		&i.TokensIssuedBefore,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastCounter,
+		&i.FailedLoginAttempts,
+		&i.LastFailedLoginAt,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.DeletionRequestedAt,
+		&i.LoginBlockedUntil,
 	)
 	return i, err
 }
@@ -53,8 +151,106 @@ func (q *Queries) DeleteAllUsers(ctx context.Context) error {
 	return err
 }
 
+const deleteUsersRequestedBefore = `-- name: DeleteUsersRequestedBefore :execrows
+DELETE FROM users WHERE deletion_requested_at < $1
+`
+
+func (q *Queries) DeleteUsersRequestedBefore(ctx context.Context, deletionRequestedAt sql.NullTime) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUsersRequestedBefore, deletionRequestedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const disableTOTPUserWithID = `-- name: DisableTOTPUserWithID :exec
+UPDATE users SET updated_at = NOW(), totp_secret = NULL, totp_enabled = false, totp_last_counter = 0 WHERE id = $1
+`
+
+func (q *Queries) DisableTOTPUserWithID(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, disableTOTPUserWithID, id)
+	return err
+}
+
+const enableTOTPUserWithID = `-- name: EnableTOTPUserWithID :exec
+UPDATE users SET updated_at = NOW(), totp_enabled = true, totp_last_counter = $2 WHERE id = $1
+`
+
+type EnableTOTPUserWithIDParams struct {
+	ID              uuid.UUID
+	TotpLastCounter int64
+}
+
+func (q *Queries) EnableTOTPUserWithID(ctx context.Context, arg EnableTOTPUserWithIDParams) error {
+	_, err := q.db.ExecContext(ctx, enableTOTPUserWithID, arg.ID, arg.TotpLastCounter)
+	return err
+}
+
+const extendLoginBlockUserWithID = `-- name: ExtendLoginBlockUserWithID :exec
+UPDATE users SET login_blocked_until = $2 WHERE id = $1 AND login_blocked_until < $2
+`
+
+type ExtendLoginBlockUserWithIDParams struct {
+	ID                uuid.UUID
+	LoginBlockedUntil sql.NullTime
+}
+
+func (q *Queries) ExtendLoginBlockUserWithID(ctx context.Context, arg ExtendLoginBlockUserWithIDParams) error {
+	_, err := q.db.ExecContext(ctx, extendLoginBlockUserWithID, arg.ID, arg.LoginBlockedUntil)
+	return err
+}
+
+const forgetExpiredFailedLoginsUserWithID = `-- name: ForgetExpiredFailedLoginsUserWithID :exec
+UPDATE users SET failed_login_attempts = 0, last_failed_login_at = NULL, login_blocked_until = NULL WHERE id = $1 AND last_failed_login_at < $2
+`
+
+type ForgetExpiredFailedLoginsUserWithIDParams struct {
+	ID                uuid.UUID
+	LastFailedLoginAt sql.NullTime
+}
+
+func (q *Queries) ForgetExpiredFailedLoginsUserWithID(ctx context.Context, arg ForgetExpiredFailedLoginsUserWithIDParams) error {
+	_, err := q.db.ExecContext(ctx, forgetExpiredFailedLoginsUserWithID, arg.ID, arg.LastFailedLoginAt)
+	return err
+}
+
+const getTokensIssuedBefore = `-- name: GetTokensIssuedBefore :many
+SELECT id, tokens_issued_before FROM users WHERE tokens_issued_before IS NOT NULL
+`
+
+type GetTokensIssuedBeforeRow struct {
+	ID                 uuid.UUID
+	TokensIssuedBefore sql.NullTime
+}
+
+func (q *Queries) GetTokensIssuedBefore(ctx context.Context) ([]GetTokensIssuedBeforeRow, error) {
+	rows, err := q.db.QueryContext(ctx, getTokensIssuedBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetTokensIssuedBeforeRow
+	for rows.Next() {
+		var i GetTokensIssuedBeforeRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.TokensIssuedBefore,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users WHERE email = $1
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, suspended_until, banned, role, tokens_issued_before, totp_secret, totp_enabled, totp_last_counter, failed_login_attempts, last_failed_login_at, email_verified_at, pending_email, deletion_requested_at, login_blocked_until FROM users WHERE email = $1
 `
 
 func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
@@ -67,31 +263,96 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.SuspendedUntil,
+		&i.Banned,
+		&i.Role,
+		&i.TokensIssuedBefore,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastCounter,
+		&i.FailedLoginAttempts,
+		&i.LastFailedLoginAt,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.DeletionRequestedAt,
+		&i.LoginBlockedUntil,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, suspended_until, banned, role, tokens_issued_before, totp_secret, totp_enabled, totp_last_counter, failed_login_attempts, last_failed_login_at, email_verified_at, pending_email, deletion_requested_at, login_blocked_until FROM users WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.SuspendedUntil,
+		&i.Banned,
+		&i.Role,
+		&i.TokensIssuedBefore,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastCounter,
+		&i.FailedLoginAttempts,
+		&i.LastFailedLoginAt,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.DeletionRequestedAt,
+		&i.LoginBlockedUntil,
 	)
 	return i, err
 }
 
 const getUserFromRefreshToken = `-- name: GetUserFromRefreshToken :one
-SELECT id, users.created_at, users.updated_at, email, hashed_password, is_chirpy_red, token, refresh_tokens.created_at, refresh_tokens.updated_at, user_id, expires_at, revoked_at FROM users JOIN refresh_tokens ON users.id = refresh_tokens.user_id WHERE refresh_tokens.token = $1
+SELECT id, users.created_at, users.updated_at, email, hashed_password, is_chirpy_red, suspended_until, banned, role, tokens_issued_before, totp_secret, totp_enabled, totp_last_counter, failed_login_attempts, last_failed_login_at, email_verified_at, pending_email, deletion_requested_at, login_blocked_until, token_hash, refresh_tokens.created_at, refresh_tokens.updated_at, user_id, expires_at, revoked_at, family_id, replaced_by, token_prefix, user_agent, ip_address, last_used_at, client_id, scopes FROM users JOIN refresh_tokens ON users.id = refresh_tokens.user_id WHERE refresh_tokens.token_hash = $1
 `
 
 type GetUserFromRefreshTokenRow struct {
-	ID             uuid.UUID
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
-	Token          string
-	CreatedAt_2    time.Time
-	UpdatedAt_2    time.Time
-	UserID         uuid.UUID
-	ExpiresAt      time.Time
-	RevokedAt      sql.NullTime
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	Email               string
+	HashedPassword      string
+	IsChirpyRed         bool
+	SuspendedUntil      sql.NullTime
+	Banned              bool
+	Role                string
+	TokensIssuedBefore  sql.NullTime
+	TotpSecret          sql.NullString
+	TotpEnabled         bool
+	TotpLastCounter     int64
+	FailedLoginAttempts int32
+	LastFailedLoginAt   sql.NullTime
+	EmailVerifiedAt     sql.NullTime
+	PendingEmail        sql.NullString
+	DeletionRequestedAt sql.NullTime
+	LoginBlockedUntil   sql.NullTime
+	TokenHash           string
+	CreatedAt_2         time.Time
+	UpdatedAt_2         time.Time
+	UserID              uuid.UUID
+	ExpiresAt           time.Time
+	RevokedAt           sql.NullTime
+	FamilyID            uuid.UUID
+	ReplacedBy          sql.NullString
+	TokenPrefix         string
+	UserAgent           string
+	IpAddress           string
+	LastUsedAt          time.Time
+	ClientID            uuid.NullUUID
+	Scopes              sql.NullString
 }
 
-func (q *Queries) GetUserFromRefreshToken(ctx context.Context, token string) (GetUserFromRefreshTokenRow, error) {
-	row := q.db.QueryRowContext(ctx, getUserFromRefreshToken, token)
+func (q *Queries) GetUserFromRefreshToken(ctx context.Context, tokenHash string) (GetUserFromRefreshTokenRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserFromRefreshToken, tokenHash)
 	var i GetUserFromRefreshTokenRow
 	err := row.Scan(
 		&i.ID,
@@ -100,22 +361,97 @@ func (q *Queries) GetUserFromRefreshToken(ctx context.Context, token string) (Ge
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
-		&i.Token,
+		&i.SuspendedUntil,
+		&i.Banned,
+		&i.Role,
+		&i.TokensIssuedBefore,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastCounter,
+		&i.FailedLoginAttempts,
+		&i.LastFailedLoginAt,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.DeletionRequestedAt,
+		&i.LoginBlockedUntil,
+		&i.TokenHash,
 		&i.CreatedAt_2,
 		&i.UpdatedAt_2,
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.ReplacedBy,
+		&i.TokenPrefix,
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.LastUsedAt,
+		&i.ClientID,
+		&i.Scopes,
+	)
+	return i, err
+}
+
+const rehashPasswordUserWithID = `-- name: RehashPasswordUserWithID :exec
+UPDATE users SET hashed_password = $2 WHERE id = $1
+`
+
+type RehashPasswordUserWithIDParams struct {
+	ID             uuid.UUID
+	HashedPassword string
+}
+
+func (q *Queries) RehashPasswordUserWithID(ctx context.Context, arg RehashPasswordUserWithIDParams) error {
+	_, err := q.db.ExecContext(ctx, rehashPasswordUserWithID, arg.ID, arg.HashedPassword)
+	return err
+}
+
+const releaseLoginAttemptUserWithID = `-- name: ReleaseLoginAttemptUserWithID :exec
+UPDATE users SET failed_login_attempts = failed_login_attempts - 1 WHERE id = $1 AND failed_login_attempts > 0
+`
+
+func (q *Queries) ReleaseLoginAttemptUserWithID(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, releaseLoginAttemptUserWithID, id)
+	return err
+}
+
+const requestDeletionUserWithID = `-- name: RequestDeletionUserWithID :one
+UPDATE users SET updated_at = NOW(), deletion_requested_at = NOW() WHERE id = $1 RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, suspended_until, banned, role, tokens_issued_before, totp_secret, totp_enabled, totp_last_counter, failed_login_attempts, last_failed_login_at, email_verified_at, pending_email, deletion_requested_at, login_blocked_until
+`
+
+func (q *Queries) RequestDeletionUserWithID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, requestDeletionUserWithID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.SuspendedUntil,
+		&i.Banned,
+		&i.Role,
+		&i.TokensIssuedBefore,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastCounter,
+		&i.FailedLoginAttempts,
+		&i.LastFailedLoginAt,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.DeletionRequestedAt,
+		&i.LoginBlockedUntil,
 	)
 	return i, err
 }
 
-const promoteToRedUserWithID = `-- name: PromoteToRedUserWithID :one
-UPDATE users SET is_chirpy_red = true WHERE id = $1 RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+const resetFailedLoginsUserWithID = `-- name: ResetFailedLoginsUserWithID :one
+UPDATE users SET failed_login_attempts = 0, last_failed_login_at = NULL, login_blocked_until = NULL WHERE id = $1 RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, suspended_until, banned, role, tokens_issued_before, totp_secret, totp_enabled, totp_last_counter, failed_login_attempts, last_failed_login_at, email_verified_at, pending_email, deletion_requested_at, login_blocked_until
 `
 
-func (q *Queries) PromoteToRedUserWithID(ctx context.Context, id uuid.UUID) (User, error) {
-	row := q.db.QueryRowContext(ctx, promoteToRedUserWithID, id)
+func (q *Queries) ResetFailedLoginsUserWithID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, resetFailedLoginsUserWithID, id)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -124,22 +460,295 @@ func (q *Queries) PromoteToRedUserWithID(ctx context.Context, id uuid.UUID) (Use
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.SuspendedUntil,
+		&i.Banned,
+		&i.Role,
+		&i.TokensIssuedBefore,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastCounter,
+		&i.FailedLoginAttempts,
+		&i.LastFailedLoginAt,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.DeletionRequestedAt,
+		&i.LoginBlockedUntil,
 	)
 	return i, err
 }
 
-const updateUserWithID = `-- name: UpdateUserWithID :one
-UPDATE users SET updated_at = NOW(), hashed_password = $2, email = $3 WHERE id = $1 RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+const setBannedUserWithID = `-- name: SetBannedUserWithID :one
+UPDATE users SET updated_at = NOW(), banned = $2 WHERE id = $1 RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, suspended_until, banned, role, tokens_issued_before, totp_secret, totp_enabled, totp_last_counter, failed_login_attempts, last_failed_login_at, email_verified_at, pending_email, deletion_requested_at, login_blocked_until
 `
 
-type UpdateUserWithIDParams struct {
+type SetBannedUserWithIDParams struct {
+	ID     uuid.UUID
+	Banned bool
+}
+
+func (q *Queries) SetBannedUserWithID(ctx context.Context, arg SetBannedUserWithIDParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setBannedUserWithID, arg.ID, arg.Banned)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.SuspendedUntil,
+		&i.Banned,
+		&i.Role,
+		&i.TokensIssuedBefore,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastCounter,
+		&i.FailedLoginAttempts,
+		&i.LastFailedLoginAt,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.DeletionRequestedAt,
+		&i.LoginBlockedUntil,
+	)
+	return i, err
+}
+
+const setChirpyRedUserWithID = `-- name: SetChirpyRedUserWithID :one
+UPDATE users SET updated_at = NOW(), is_chirpy_red = $2 WHERE id = $1 RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, suspended_until, banned, role, tokens_issued_before, totp_secret, totp_enabled, totp_last_counter, failed_login_attempts, last_failed_login_at, email_verified_at, pending_email, deletion_requested_at, login_blocked_until
+`
+
+type SetChirpyRedUserWithIDParams struct {
+	ID          uuid.UUID
+	IsChirpyRed bool
+}
+
+func (q *Queries) SetChirpyRedUserWithID(ctx context.Context, arg SetChirpyRedUserWithIDParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setChirpyRedUserWithID, arg.ID, arg.IsChirpyRed)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.SuspendedUntil,
+		&i.Banned,
+		&i.Role,
+		&i.TokensIssuedBefore,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastCounter,
+		&i.FailedLoginAttempts,
+		&i.LastFailedLoginAt,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.DeletionRequestedAt,
+		&i.LoginBlockedUntil,
+	)
+	return i, err
+}
+
+const setEmailVerifiedUserWithID = `-- name: SetEmailVerifiedUserWithID :one
+UPDATE users SET updated_at = NOW(), email_verified_at = NOW() WHERE id = $1 AND email = $2 RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, suspended_until, banned, role, tokens_issued_before, totp_secret, totp_enabled, totp_last_counter, failed_login_attempts, last_failed_login_at, email_verified_at, pending_email, deletion_requested_at, login_blocked_until
+`
+
+type SetEmailVerifiedUserWithIDParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+func (q *Queries) SetEmailVerifiedUserWithID(ctx context.Context, arg SetEmailVerifiedUserWithIDParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setEmailVerifiedUserWithID, arg.ID, arg.Email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.SuspendedUntil,
+		&i.Banned,
+		&i.Role,
+		&i.TokensIssuedBefore,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastCounter,
+		&i.FailedLoginAttempts,
+		&i.LastFailedLoginAt,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.DeletionRequestedAt,
+		&i.LoginBlockedUntil,
+	)
+	return i, err
+}
+
+const setPendingEmailUserWithID = `-- name: SetPendingEmailUserWithID :exec
+UPDATE users SET updated_at = NOW(), pending_email = $2 WHERE id = $1
+`
+
+type SetPendingEmailUserWithIDParams struct {
+	ID           uuid.UUID
+	PendingEmail sql.NullString
+}
+
+func (q *Queries) SetPendingEmailUserWithID(ctx context.Context, arg SetPendingEmailUserWithIDParams) error {
+	_, err := q.db.ExecContext(ctx, setPendingEmailUserWithID, arg.ID, arg.PendingEmail)
+	return err
+}
+
+const setRoleUserWithID = `-- name: SetRoleUserWithID :one
+UPDATE users SET updated_at = NOW(), role = $2 WHERE id = $1 RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, suspended_until, banned, role, tokens_issued_before, totp_secret, totp_enabled, totp_last_counter, failed_login_attempts, last_failed_login_at, email_verified_at, pending_email, deletion_requested_at, login_blocked_until
+`
+
+type SetRoleUserWithIDParams struct {
+	ID   uuid.UUID
+	Role string
+}
+
+func (q *Queries) SetRoleUserWithID(ctx context.Context, arg SetRoleUserWithIDParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setRoleUserWithID, arg.ID, arg.Role)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.SuspendedUntil,
+		&i.Banned,
+		&i.Role,
+		&i.TokensIssuedBefore,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastCounter,
+		&i.FailedLoginAttempts,
+		&i.LastFailedLoginAt,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.DeletionRequestedAt,
+		&i.LoginBlockedUntil,
+	)
+	return i, err
+}
+
+const setTOTPLastCounterUserWithID = `-- name: SetTOTPLastCounterUserWithID :execrows
+UPDATE users SET totp_last_counter = $2 WHERE id = $1 AND totp_last_counter < $2
+`
+
+type SetTOTPLastCounterUserWithIDParams struct {
+	ID              uuid.UUID
+	TotpLastCounter int64
+}
+
+func (q *Queries) SetTOTPLastCounterUserWithID(ctx context.Context, arg SetTOTPLastCounterUserWithIDParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setTOTPLastCounterUserWithID, arg.ID, arg.TotpLastCounter)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setTOTPSecretUserWithID = `-- name: SetTOTPSecretUserWithID :one
+UPDATE users SET updated_at = NOW(), totp_secret = $2, totp_enabled = false WHERE id = $1 RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, suspended_until, banned, role, tokens_issued_before, totp_secret, totp_enabled, totp_last_counter, failed_login_attempts, last_failed_login_at, email_verified_at, pending_email, deletion_requested_at, login_blocked_until
+`
+
+type SetTOTPSecretUserWithIDParams struct {
+	ID         uuid.UUID
+	TotpSecret sql.NullString
+}
+
+func (q *Queries) SetTOTPSecretUserWithID(ctx context.Context, arg SetTOTPSecretUserWithIDParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setTOTPSecretUserWithID, arg.ID, arg.TotpSecret)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.SuspendedUntil,
+		&i.Banned,
+		&i.Role,
+		&i.TokensIssuedBefore,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastCounter,
+		&i.FailedLoginAttempts,
+		&i.LastFailedLoginAt,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.DeletionRequestedAt,
+		&i.LoginBlockedUntil,
+	)
+	return i, err
+}
+
+const setTokensIssuedBeforeUserWithID = `-- name: SetTokensIssuedBeforeUserWithID :exec
+UPDATE users SET updated_at = NOW(), tokens_issued_before = $2 WHERE id = $1
+`
+
+type SetTokensIssuedBeforeUserWithIDParams struct {
+	ID                 uuid.UUID
+	TokensIssuedBefore sql.NullTime
+}
+
+func (q *Queries) SetTokensIssuedBeforeUserWithID(ctx context.Context, arg SetTokensIssuedBeforeUserWithIDParams) error {
+	_, err := q.db.ExecContext(ctx, setTokensIssuedBeforeUserWithID, arg.ID, arg.TokensIssuedBefore)
+	return err
+}
+
+const suspendUserWithID = `-- name: SuspendUserWithID :one
+UPDATE users SET updated_at = NOW(), suspended_until = $2 WHERE id = $1 RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, suspended_until, banned, role, tokens_issued_before, totp_secret, totp_enabled, totp_last_counter, failed_login_attempts, last_failed_login_at, email_verified_at, pending_email, deletion_requested_at, login_blocked_until
+`
+
+type SuspendUserWithIDParams struct {
+	ID             uuid.UUID
+	SuspendedUntil sql.NullTime
+}
+
+func (q *Queries) SuspendUserWithID(ctx context.Context, arg SuspendUserWithIDParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, suspendUserWithID, arg.ID, arg.SuspendedUntil)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.SuspendedUntil,
+		&i.Banned,
+		&i.Role,
+		&i.TokensIssuedBefore,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastCounter,
+		&i.FailedLoginAttempts,
+		&i.LastFailedLoginAt,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.DeletionRequestedAt,
+		&i.LoginBlockedUntil,
+	)
+	return i, err
+}
+
+const updatePasswordUserWithID = `-- name: UpdatePasswordUserWithID :one
+UPDATE users SET updated_at = NOW(), hashed_password = $2 WHERE id = $1 RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, suspended_until, banned, role, tokens_issued_before, totp_secret, totp_enabled, totp_last_counter, failed_login_attempts, last_failed_login_at, email_verified_at, pending_email, deletion_requested_at, login_blocked_until
+`
+
+type UpdatePasswordUserWithIDParams struct {
 	ID             uuid.UUID
 	HashedPassword string
-	Email          string
 }
 
-func (q *Queries) UpdateUserWithID(ctx context.Context, arg UpdateUserWithIDParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, updateUserWithID, arg.ID, arg.HashedPassword, arg.Email)
+func (q *Queries) UpdatePasswordUserWithID(ctx context.Context, arg UpdatePasswordUserWithIDParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updatePasswordUserWithID, arg.ID, arg.HashedPassword)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -148,6 +757,19 @@ func (q *Queries) UpdateUserWithID(ctx context.Context, arg UpdateUserWithIDPara
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.SuspendedUntil,
+		&i.Banned,
+		&i.Role,
+		&i.TokensIssuedBefore,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastCounter,
+		&i.FailedLoginAttempts,
+		&i.LastFailedLoginAt,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.DeletionRequestedAt,
+		&i.LoginBlockedUntil,
 	)
 	return i, err
 }
@@ -0,0 +1,59 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Archive collects the JSON files of a personal data export.
+type Archive struct {
+	files map[string]any
+}
+
+func NewArchive() *Archive {
+	return &Archive{files: map[string]any{}}
+}
+
+// Add stores data as name, which should end in .json. Adding a name twice
+// replaces the earlier data.
+func (a *Archive) Add(name string, data any) {
+	a.files[name] = data
+}
+
+// ZIP encodes every file as indented JSON and returns them zipped, sorted
+// by name and dated at createdAt.
+func (a *Archive) ZIP(createdAt time.Time) ([]byte, error) {
+	names := make([]string, 0, len(a.files))
+	for name := range a.files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	buf := bytes.Buffer{}
+	zw := zip.NewWriter(&buf)
+	for _, name := range names {
+		content, err := json.MarshalIndent(a.files[name], "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed encoding %v: %v", name, err)
+		}
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   zip.Deflate,
+			Modified: createdAt,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed adding %v: %v", name, err)
+		}
+		if _, err := fw.Write(append(content, '\n')); err != nil {
+			return nil, fmt.Errorf("failed writing %v: %v", name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed finishing the archive: %v", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,68 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestArchiveZIP(t *testing.T) {
+	archive := NewArchive()
+	archive.Add("profile.json", map[string]any{"email": "walt@breakingbad.com", "is_chirpy_red": true})
+	archive.Add("chirps.json", []string{"I'm the one who knocks"})
+	archive.Add("sessions.json", []string{})
+
+	createdAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	data, err := archive.ZIP(createdAt)
+	if err != nil {
+		t.Errorf("ZIP failed with: %v", err)
+		return
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Errorf("the archive can't be read: %v", err)
+		return
+	}
+	expected := []string{"chirps.json", "profile.json", "sessions.json"}
+	if len(zr.File) != len(expected) {
+		t.Errorf("the archive has %v files, expected %v", len(zr.File), len(expected))
+		return
+	}
+	for i, f := range zr.File {
+		if f.Name != expected[i] || !f.Modified.Equal(createdAt) {
+			t.Errorf("file %v is %v from %v", i, f.Name, f.Modified)
+			return
+		}
+	}
+
+	rc, err := zr.File[1].Open()
+	if err != nil {
+		t.Errorf("failed opening profile.json: %v", err)
+		return
+	}
+	defer rc.Close()
+	content, err := io.ReadAll(rc)
+	if err != nil {
+		t.Errorf("failed reading profile.json: %v", err)
+		return
+	}
+	profile := map[string]any{}
+	if err := json.Unmarshal(content, &profile); err != nil {
+		t.Errorf("profile.json isn't JSON: %v", err)
+		return
+	}
+	if profile["email"] != "walt@breakingbad.com" || profile["is_chirpy_red"] != true {
+		t.Errorf("unexpected profile.json: %s", content)
+		return
+	}
+
+	archive.Add("broken.json", func() {})
+	if _, err := archive.ZIP(createdAt); err == nil {
+		t.Errorf("ZIP accepted data that can't be encoded")
+		return
+	}
+}
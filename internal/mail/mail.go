@@ -0,0 +1,125 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrInvalidAddress = errors.New("invalid email address")
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends plain text mail.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NormalizeAddress checks that address is a bare email address, without a
+// display name, and returns it lowercased so addresses compare
+// case-insensitively.
+func NormalizeAddress(address string) (string, error) {
+	address = strings.TrimSpace(address)
+	parsed, err := netmail.ParseAddress(address)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	}
+	if parsed.Name != "" || parsed.Address != address {
+		return "", fmt.Errorf("%w: %q isn't a bare address", ErrInvalidAddress, address)
+	}
+	_, domain, _ := strings.Cut(parsed.Address, "@")
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return "", fmt.Errorf("%w: %q isn't a valid domain", ErrInvalidAddress, domain)
+	}
+	return strings.ToLower(parsed.Address), nil
+}
+
+func format(from string, msg Message, now time.Time) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+func checkHeaders(msg Message) error {
+	if strings.ContainsAny(msg.To, "\r\n") || strings.ContainsAny(msg.Subject, "\r\n") {
+		return errors.New("mail headers must not contain line breaks")
+	}
+	return nil
+}
+
+// SMTPMailer sends mail through an SMTP server, authenticating with PLAIN
+// auth if Username is set.
+type SMTPMailer struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+func (m SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := checkHeaders(msg); err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, err := net.SplitHostPort(m.Addr)
+		if err != nil {
+			return fmt.Errorf("invalid SMTP address: %v", err)
+		}
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+
+	// net/smtp doesn't take a context, so the send is abandoned rather than
+	// interrupted when ctx is done
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(m.Addr, auth, m.From, []string{msg.To}, format(m.From, msg, time.Now()))
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("failed sending mail: %v", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// LogMailer writes mail to Writer instead of sending it, for development and
+// tests.
+type LogMailer struct {
+	From   string
+	Writer io.Writer
+	mu     sync.Mutex
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	if err := checkHeaders(msg); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := fmt.Fprintf(m.Writer, "%s\r\n.\r\n", format(m.From, msg, time.Now())); err != nil {
+		return fmt.Errorf("failed writing mail: %v", err)
+	}
+	return nil
+}
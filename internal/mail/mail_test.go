@@ -0,0 +1,69 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeAddress(t *testing.T) {
+	cases := []struct {
+		Input    string
+		Expected string
+		WantErr  bool
+	}{
+		{Input: "walt@breakingbad.com", Expected: "walt@breakingbad.com"},
+		{Input: " Walt@BreakingBad.com ", Expected: "walt@breakingbad.com"},
+		{Input: "walt.white+chirpy@mail.breakingbad.com", Expected: "walt.white+chirpy@mail.breakingbad.com"},
+		{Input: "", WantErr: true},
+		{Input: "walt", WantErr: true},
+		{Input: "walt@localhost", WantErr: true},
+		{Input: "walt@breakingbad.", WantErr: true},
+		{Input: "Walter White <walt@breakingbad.com>", WantErr: true},
+		{Input: "walt@breakingbad.com, jesse@breakingbad.com", WantErr: true},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", i), func(t *testing.T) {
+			actual, err := NormalizeAddress(c.Input)
+			if c.WantErr {
+				if !errors.Is(err, ErrInvalidAddress) {
+					t.Errorf("NormalizeAddress(%q) = %q, %v, expected ErrInvalidAddress", c.Input, actual, err)
+				}
+				return
+			}
+			if err != nil || actual != c.Expected {
+				t.Errorf("NormalizeAddress(%q) = %q, %v, expected %q", c.Input, actual, err, c.Expected)
+				return
+			}
+		})
+	}
+}
+
+func TestLogMailer(t *testing.T) {
+	out := strings.Builder{}
+	mailer := &LogMailer{From: "chirpy@example.com", Writer: &out}
+
+	err := mailer.Send(context.Background(), Message{
+		To:      "walt@breakingbad.com",
+		Subject: "Verify your email",
+		Body:    "line one\nline two",
+	})
+	if err != nil {
+		t.Errorf("Send failed with: %v", err)
+		return
+	}
+	for _, expected := range []string{"From: chirpy@example.com\r\n", "To: walt@breakingbad.com\r\n", "Subject: Verify your email\r\n", "\r\n\r\nline one\r\nline two"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("mail %q doesn't contain %q", out.String(), expected)
+			return
+		}
+	}
+
+	if err := mailer.Send(context.Background(), Message{To: "walt@breakingbad.com", Subject: "Hi\r\nBcc: jesse@breakingbad.com"}); err == nil {
+		t.Errorf("Send accepted a header injection")
+		return
+	}
+}
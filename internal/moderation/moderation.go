@@ -0,0 +1,207 @@
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/marekmchl/Chirpy/internal/profanity"
+)
+
+type Action int
+
+const (
+	ActionAllow Action = iota
+	ActionMask
+	ActionHold
+	ActionReject
+)
+
+// Verdict is what a single stage decided about a chirp. Body, when set,
+// replaces the chirp's text whatever the action, Reason is only read for
+// ActionHold and ActionReject.
+type Verdict struct {
+	Action Action
+	Body   string
+	Reason string
+}
+
+type Stage interface {
+	Name() string
+	Moderate(ctx context.Context, body string) (Verdict, error)
+}
+
+// Result is the outcome of running a chirp through the whole pipeline.
+// Stage and Reason are set when the chirp was rejected, HeldBy lists the
+// stages that want the chirp reviewed before it is shown and HoldReasons
+// why, in the same order.
+type Result struct {
+	Body        string
+	Rejected    bool
+	Stage       string
+	Reason      string
+	HeldBy      []string
+	HoldReasons []string
+}
+
+type Pipeline struct {
+	stages []Stage
+}
+
+func NewPipeline(stages ...Stage) *Pipeline {
+	return &Pipeline{stages: stages}
+}
+
+// Run passes body through every stage in order. Masked bodies are handed to
+// the following stages and the first rejection stops the pipeline.
+func (p *Pipeline) Run(ctx context.Context, body string) (Result, error) {
+	result := Result{Body: body}
+	for _, stage := range p.stages {
+		verdict, err := stage.Moderate(ctx, result.Body)
+		if err != nil {
+			return Result{}, fmt.Errorf("stage %v failed with: %v", stage.Name(), err)
+		}
+		if verdict.Body != "" {
+			result.Body = verdict.Body
+		}
+		switch verdict.Action {
+		case ActionHold:
+			result.HeldBy = append(result.HeldBy, stage.Name())
+			result.HoldReasons = append(result.HoldReasons, verdict.Reason)
+		case ActionReject:
+			result.Rejected = true
+			result.Stage = stage.Name()
+			result.Reason = verdict.Reason
+			return result, nil
+		}
+	}
+	return result, nil
+}
+
+type WordListStage struct {
+	Filter *profanity.Filter
+}
+
+func (s WordListStage) Name() string {
+	return "word_list"
+}
+
+func (s WordListStage) Moderate(ctx context.Context, body string) (Verdict, error) {
+	checked := s.Filter.Check(body)
+	if len(checked.Rejected) > 0 {
+		return Verdict{
+			Action: ActionReject,
+			Reason: fmt.Sprintf("contains blocked words: %v", strings.Join(checked.Rejected, ", ")),
+		}, nil
+	}
+	if len(checked.Flagged) > 0 {
+		// masked words stay masked while the chirp waits for review
+		return Verdict{
+			Action: ActionHold,
+			Body:   checked.Text,
+			Reason: fmt.Sprintf("contains flagged words: %v", strings.Join(checked.Flagged, ", ")),
+		}, nil
+	}
+	if checked.Text != body {
+		return Verdict{Action: ActionMask, Body: checked.Text}, nil
+	}
+	return Verdict{Action: ActionAllow}, nil
+}
+
+// LinkBlocklistStage rejects chirps linking to a blocked domain or any of
+// its subdomains.
+type LinkBlocklistStage struct {
+	Domains []string
+}
+
+func (s LinkBlocklistStage) Name() string {
+	return "link_blocklist"
+}
+
+func (s LinkBlocklistStage) Moderate(ctx context.Context, body string) (Verdict, error) {
+	for _, field := range strings.Fields(body) {
+		host := linkHost(field)
+		if host == "" {
+			continue
+		}
+		for _, domain := range s.Domains {
+			domain = strings.ToLower(strings.TrimSpace(domain))
+			if domain == "" {
+				continue
+			}
+			if host == domain || strings.HasSuffix(host, "."+domain) {
+				return Verdict{
+					Action: ActionReject,
+					Reason: fmt.Sprintf("links to blocked domain %v", domain),
+				}, nil
+			}
+		}
+	}
+	return Verdict{Action: ActionAllow}, nil
+}
+
+// linkHost returns the lowercase host of a word that looks like a link,
+// with or without a scheme, or "" if it doesn't look like one.
+func linkHost(word string) string {
+	word = strings.ToLower(strings.TrimFunc(word, func(r rune) bool {
+		return unicode.IsPunct(r) && r != '/'
+	}))
+	hasScheme := false
+	for _, scheme := range []string{"https://", "http://"} {
+		if strings.HasPrefix(word, scheme) {
+			word = word[len(scheme):]
+			hasScheme = true
+			break
+		}
+	}
+	if i := strings.IndexAny(word, "/?#"); i >= 0 {
+		word = word[:i]
+	}
+	if i := strings.LastIndex(word, "@"); i >= 0 {
+		word = word[i+1:]
+	}
+	if i := strings.Index(word, ":"); i >= 0 {
+		word = word[:i]
+	}
+	word = strings.TrimSuffix(word, ".")
+	if !hasScheme && !strings.Contains(word, ".") {
+		return ""
+	}
+	return word
+}
+
+// RepeatedCharactersStage rejects chirps with a run of more than MaxRun
+// identical characters, ignoring whitespace.
+type RepeatedCharactersStage struct {
+	MaxRun int
+}
+
+func (s RepeatedCharactersStage) Name() string {
+	return "repeated_characters"
+}
+
+func (s RepeatedCharactersStage) Moderate(ctx context.Context, body string) (Verdict, error) {
+	var prev rune
+	run := 0
+	for _, r := range body {
+		if unicode.IsSpace(r) {
+			run = 0
+			continue
+		}
+		r = unicode.ToLower(r)
+		if r == prev && run > 0 {
+			run++
+		} else {
+			prev = r
+			run = 1
+		}
+		if run > s.MaxRun {
+			return Verdict{
+				Action: ActionReject,
+				Reason: fmt.Sprintf("more than %d repeated '%c' characters", s.MaxRun, r),
+			}, nil
+		}
+	}
+	return Verdict{Action: ActionAllow}, nil
+}
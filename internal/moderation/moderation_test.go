@@ -0,0 +1,98 @@
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/marekmchl/Chirpy/internal/profanity"
+)
+
+func TestPipeline(t *testing.T) {
+	filter := profanity.NewFilter(nil)
+	filter.SetEntries([]profanity.Entry{
+		{Word: "kerfuffle", Action: profanity.ActionMask},
+		{Word: "sharbert", Action: profanity.ActionReject},
+		{Word: "fornax", Action: profanity.ActionFlag},
+	})
+	pipeline := NewPipeline(
+		WordListStage{Filter: filter},
+		LinkBlocklistStage{Domains: []string{"spam.example"}},
+		RepeatedCharactersStage{MaxRun: 5},
+	)
+
+	cases := []struct {
+		Body     string
+		Expected Result
+	}{
+		{
+			Body:     "What a nice day",
+			Expected: Result{Body: "What a nice day"},
+		},
+		{
+			Body:     "What a kerfuffle!",
+			Expected: Result{Body: "What a ****!"},
+		},
+		{
+			Body: "Bring the fornax",
+			Expected: Result{
+				Body:        "Bring the fornax",
+				HeldBy:      []string{"word_list"},
+				HoldReasons: []string{"contains flagged words: fornax"},
+			},
+		},
+		{
+			Body: "Bring the fornax to the kerfuffle",
+			Expected: Result{
+				Body:        "Bring the fornax to the ****",
+				HeldBy:      []string{"word_list"},
+				HoldReasons: []string{"contains flagged words: fornax"},
+			},
+		},
+		{
+			Body: "Such a sharbert",
+			Expected: Result{
+				Body:     "Such a sharbert",
+				Rejected: true,
+				Stage:    "word_list",
+				Reason:   "contains blocked words: sharbert",
+			},
+		},
+		{
+			Body: "Go to https://www.spam.example/win now",
+			Expected: Result{
+				Body:     "Go to https://www.spam.example/win now",
+				Rejected: true,
+				Stage:    "link_blocklist",
+				Reason:   "links to blocked domain spam.example",
+			},
+		},
+		{
+			Body:     "Go to https://notspam.example/win now",
+			Expected: Result{Body: "Go to https://notspam.example/win now"},
+		},
+		{
+			Body: "kerfuffle nooooooo",
+			Expected: Result{
+				Body:     "**** nooooooo",
+				Rejected: true,
+				Stage:    "repeated_characters",
+				Reason:   "more than 5 repeated 'o' characters",
+			},
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", i), func(t *testing.T) {
+			result, err := pipeline.Run(context.Background(), c.Body)
+			if err != nil {
+				t.Errorf("Run failed with: %v", err)
+				return
+			}
+			if fmt.Sprint(result) != fmt.Sprint(c.Expected) {
+				t.Errorf("Run(%q) = %+v, expected %+v", c.Body, result, c.Expected)
+				return
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package oauth
+
+import (
+	"errors"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/marekmchl/Chirpy/internal/auth"
+)
+
+var consentTemplate = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Authorize {{.Client.Name}} - Chirpy</title>
+</head>
+<body>
+<h1>Authorize {{.Client.Name}}</h1>
+<p>{{.Client.Name}} wants to access your Chirpy account and will be able to:</p>
+<ul>
+{{range .Scopes}}<li>{{.}}</li>
+{{end}}</ul>
+{{if .Error}}<p role="alert">{{.Error}}</p>
+{{end}}<form method="post" action="">
+<input type="hidden" name="response_type" value="code">
+<input type="hidden" name="client_id" value="{{.Client.ID}}">
+<input type="hidden" name="redirect_uri" value="{{.RedirectURI}}">
+<input type="hidden" name="scope" value="{{.Scope}}">
+<input type="hidden" name="state" value="{{.State}}">
+<input type="hidden" name="code_challenge" value="{{.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="S256">
+<label>Email <input type="email" name="email" autocomplete="username"></label>
+<label>Password <input type="password" name="password" autocomplete="current-password"></label>
+<label>Two-factor code, if enabled <input type="text" name="code" inputmode="numeric" autocomplete="one-time-code"></label>
+<button type="submit" name="action" value="approve">Allow</button>
+<button type="submit" name="action" value="deny">Deny</button>
+</form>
+</body>
+</html>
+`))
+
+type authorizeRequest struct {
+	Client        Client
+	RedirectURI   string
+	Scope         string
+	Scopes        []string
+	State         string
+	CodeChallenge string
+	Error         string
+}
+
+// authorizeError is an invalid authorization request. Unless redirect is
+// set, the client or redirect URI can't be trusted and the error must be
+// shown to the user instead of being sent back to the client.
+type authorizeError struct {
+	code        string
+	description string
+	redirect    bool
+}
+
+func (e *authorizeError) Error() string {
+	return e.description
+}
+
+func (s *Server) parseAuthorizeRequest(r *http.Request, values url.Values) (authorizeRequest, error) {
+	req := authorizeRequest{
+		RedirectURI:   values.Get("redirect_uri"),
+		State:         values.Get("state"),
+		CodeChallenge: values.Get("code_challenge"),
+	}
+
+	clientID, err := uuid.Parse(values.Get("client_id"))
+	if err != nil {
+		return req, &authorizeError{code: "invalid_request", description: "invalid client_id"}
+	}
+	req.Client, err = s.Store.GetClient(r.Context(), clientID)
+	if errors.Is(err, ErrNotFound) {
+		return req, &authorizeError{code: "invalid_request", description: "unknown client"}
+	}
+	if err != nil {
+		return req, err
+	}
+	if !slices.Contains(req.Client.RedirectURIs, req.RedirectURI) {
+		return req, &authorizeError{code: "invalid_request", description: "redirect_uri isn't registered for this client"}
+	}
+
+	if values.Get("response_type") != "code" {
+		return req, &authorizeError{code: "unsupported_response_type", description: "only the code response type is supported", redirect: true}
+	}
+	if req.CodeChallenge == "" || values.Get("code_challenge_method") != "S256" {
+		return req, &authorizeError{code: "invalid_request", description: "a S256 code_challenge is required", redirect: true}
+	}
+	req.Scopes, err = allowedScopes(req.Client, strings.Fields(values.Get("scope")))
+	if err != nil {
+		return req, &authorizeError{code: "invalid_scope", description: err.Error(), redirect: true}
+	}
+	req.Scope = auth.FormatScopes(req.Scopes)
+	return req, nil
+}
+
+// handleAuthorizeError reports err and returns true if there is one.
+func handleAuthorizeError(w http.ResponseWriter, r *http.Request, req authorizeRequest, err error) bool {
+	if err == nil {
+		return false
+	}
+	var authErr *authorizeError
+	if !errors.As(err, &authErr) {
+		http.Error(w, "Failed checking the authorization request: "+err.Error(), 500)
+		return true
+	}
+	if !authErr.redirect {
+		http.Error(w, "Invalid authorization request: "+authErr.description, 400)
+		return true
+	}
+	redirectError(w, r, req, authErr.code, authErr.description)
+	return true
+}
+
+func redirectWithParams(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "Invalid redirect_uri", 400)
+		return
+	}
+	query := u.Query()
+	for key, values := range params {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
+	u.RawQuery = query.Encode()
+	http.Redirect(w, r, u.String(), http.StatusSeeOther)
+}
+
+func redirectError(w http.ResponseWriter, r *http.Request, req authorizeRequest, code, description string) {
+	params := url.Values{"error": {code}, "error_description": {description}}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	redirectWithParams(w, r, req.RedirectURI, params)
+}
+
+func renderConsent(w http.ResponseWriter, status int, req authorizeRequest) {
+	w.Header().Add("Content-Type", "text/html; charset=utf-8")
+	w.Header().Add("X-Frame-Options", "DENY")
+	w.Header().Add("Content-Security-Policy", "frame-ancestors 'none'")
+	w.Header().Add("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := consentTemplate.Execute(w, req); err != nil {
+		log.Printf("failed rendering the consent page: %v", err)
+	}
+}
+
+// HandleAuthorize shows the consent page for an authorization request.
+func (s *Server) HandleAuthorize(w http.ResponseWriter, r *http.Request) {
+	req, err := s.parseAuthorizeRequest(r, r.URL.Query())
+	if handleAuthorizeError(w, r, req, err) {
+		return
+	}
+	renderConsent(w, 200, req)
+}
+
+// HandleAuthorizeDecision handles the consent form. Approving logs the user
+// in and redirects back to the client with an authorization code.
+func (s *Server) HandleAuthorizeDecision(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed parsing the form: "+err.Error(), 400)
+		return
+	}
+	req, err := s.parseAuthorizeRequest(r, r.PostForm)
+	if handleAuthorizeError(w, r, req, err) {
+		return
+	}
+	if r.PostForm.Get("action") != "approve" {
+		redirectError(w, r, req, "access_denied", "the user denied the request")
+		return
+	}
+
+	userID, err := s.Store.AuthenticateUser(r.Context(), clientIP(r), r.PostForm.Get("email"), r.PostForm.Get("password"), r.PostForm.Get("code"))
+	if errors.Is(err, ErrInvalidLogin) {
+		req.Error = "Incorrect email, password or two-factor code"
+		renderConsent(w, 401, req)
+		return
+	}
+	if errors.Is(err, ErrAccountRestricted) {
+		req.Error = err.Error()
+		renderConsent(w, 403, req)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed logging in: "+err.Error(), 500)
+		return
+	}
+
+	code, err := MakeClientSecret()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if err := s.Store.CreateAuthorizationCode(r.Context(), AuthorizationCode{
+		CodeHash:      HashSecret(code),
+		ClientID:      req.Client.ID,
+		UserID:        userID,
+		RedirectURI:   req.RedirectURI,
+		Scopes:        req.Scopes,
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     time.Now().Add(s.CodeDuration),
+	}); err != nil {
+		http.Error(w, "Failed saving the authorization code: "+err.Error(), 500)
+		return
+	}
+
+	params := url.Values{"code": {code}}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	redirectWithParams(w, r, req.RedirectURI, params)
+}
+
+// clientIP returns the address the request came from, without the port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
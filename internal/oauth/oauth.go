@@ -0,0 +1,155 @@
+// Package oauth implements the OAuth 2.0 authorization code flow with PKCE
+// (RFC 6749, RFC 7636) and token introspection (RFC 7662) on top of a Store.
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/marekmchl/Chirpy/internal/auth"
+)
+
+var (
+	ErrNotFound         = errors.New("not found")
+	ErrInvalidLogin     = errors.New("invalid email or password")
+	ErrRefreshTokenUsed = errors.New("refresh token already used")
+	// ErrAccountRestricted is wrapped by Store errors for users who may not
+	// log in.
+	ErrAccountRestricted = errors.New("account restricted")
+)
+
+// Client is a registered third-party application. Public clients have no
+// secret and rely on PKCE alone.
+type Client struct {
+	ID           uuid.UUID
+	Name         string
+	SecretHash   string
+	RedirectURIs []string
+	Scopes       []string
+}
+
+func (c Client) Confidential() bool {
+	return c.SecretHash != ""
+}
+
+func (c Client) CheckSecret(secret string) bool {
+	return c.Confidential() && subtle.ConstantTimeCompare([]byte(c.SecretHash), []byte(HashSecret(secret))) == 1
+}
+
+type AuthorizationCode struct {
+	CodeHash      string
+	ClientID      uuid.UUID
+	UserID        uuid.UUID
+	RedirectURI   string
+	Scopes        []string
+	CodeChallenge string
+	ExpiresAt     time.Time
+}
+
+// RefreshToken is a refresh token issued to a client. Replaced is set once
+// it has been rotated.
+type RefreshToken struct {
+	TokenHash   string
+	TokenPrefix string
+	FamilyID    uuid.UUID
+	UserID      uuid.UUID
+	ClientID    uuid.UUID
+	Scopes      []string
+	IssuedAt    time.Time
+	ExpiresAt   time.Time
+	Revoked     bool
+	Replaced    bool
+}
+
+// Store persists clients, authorization codes and refresh tokens and checks
+// user credentials.
+type Store interface {
+	GetClient(ctx context.Context, clientID uuid.UUID) (Client, error)
+	// AuthenticateUser returns the user with these credentials, or an error
+	// if they are wrong or the user may not log in. ip is the address the
+	// attempt came from, for throttling. code is the TOTP code of users with
+	// two-factor authentication enabled.
+	AuthenticateUser(ctx context.Context, ip, email, password, code string) (uuid.UUID, error)
+	// CheckUser returns an error if the user may no longer use the API.
+	CheckUser(ctx context.Context, userID uuid.UUID) error
+	CreateAuthorizationCode(ctx context.Context, code AuthorizationCode) error
+	// ConsumeAuthorizationCode returns the code and marks it used, or
+	// ErrNotFound if it doesn't exist or was already used.
+	ConsumeAuthorizationCode(ctx context.Context, codeHash string) (AuthorizationCode, error)
+	CreateRefreshToken(ctx context.Context, token RefreshToken) error
+	// GetRefreshToken looks up the stored refresh token matching token,
+	// comparing hashes in constant time.
+	GetRefreshToken(ctx context.Context, token string) (RefreshToken, error)
+	// RotateRefreshToken marks a refresh token as replaced by another, or
+	// returns ErrRefreshTokenUsed if it already was or has been revoked.
+	RotateRefreshToken(ctx context.Context, tokenHash, replacedBy string) error
+	RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error
+}
+
+// Server holds the configuration shared by the OAuth endpoints.
+type Server struct {
+	Store                Store
+	Keys                 *auth.Keyring
+	Audience             string
+	Revocations          auth.RevocationChecker
+	AccessTokenDuration  time.Duration
+	RefreshTokenDuration time.Duration
+	CodeDuration         time.Duration
+}
+
+// MakeClientSecret returns a new random client secret.
+func MakeClientSecret() (string, error) {
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", fmt.Errorf("failed to make a client secret: %v", err)
+	}
+	return hex.EncodeToString(secretBytes), nil
+}
+
+// HashSecret returns the hex SHA-256 of a client secret or authorization
+// code, which is what gets stored instead of the value itself.
+func HashSecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+// CodeChallengeS256 derives the S256 PKCE code challenge from a verifier.
+func CodeChallengeS256(verifier string) string {
+	hash := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+func checkCodeVerifier(verifier, challenge string) bool {
+	// RFC 7636 section 4.1 allows 43 to 128 characters.
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(CodeChallengeS256(verifier)), []byte(challenge)) == 1
+}
+
+// allowedScopes parses requested scopes and checks that the client may ask
+// for them. No requested scopes means all the client's scopes.
+func allowedScopes(client Client, requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return client.Scopes, nil
+	}
+	scopes, err := auth.ParseScopes(requested)
+	if err != nil {
+		return nil, err
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(client.Scopes, scope) {
+			return nil, fmt.Errorf("scope %q isn't allowed for this client", scope)
+		}
+	}
+	return scopes, nil
+}
@@ -0,0 +1,407 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/marekmchl/Chirpy/internal/auth"
+)
+
+type memoryStore struct {
+	mu            sync.Mutex
+	clients       map[uuid.UUID]Client
+	userID        uuid.UUID
+	email         string
+	password      string
+	codes         map[string]AuthorizationCode
+	refreshTokens map[string]RefreshToken
+}
+
+func (s *memoryStore) GetClient(ctx context.Context, clientID uuid.UUID) (Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	client, ok := s.clients[clientID]
+	if !ok {
+		return Client{}, ErrNotFound
+	}
+	return client, nil
+}
+
+func (s *memoryStore) AuthenticateUser(ctx context.Context, ip, email, password, code string) (uuid.UUID, error) {
+	if email != s.email || password != s.password {
+		return uuid.Nil, ErrInvalidLogin
+	}
+	return s.userID, nil
+}
+
+func (s *memoryStore) CheckUser(ctx context.Context, userID uuid.UUID) error {
+	return nil
+}
+
+func (s *memoryStore) CreateAuthorizationCode(ctx context.Context, code AuthorizationCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.codes[code.CodeHash] = code
+	return nil
+}
+
+func (s *memoryStore) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (AuthorizationCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	code, ok := s.codes[codeHash]
+	if !ok {
+		return AuthorizationCode{}, ErrNotFound
+	}
+	delete(s.codes, codeHash)
+	return code, nil
+}
+
+func (s *memoryStore) CreateRefreshToken(ctx context.Context, token RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token.IssuedAt = time.Now()
+	s.refreshTokens[token.TokenHash] = token
+	return nil
+}
+
+func (s *memoryStore) GetRefreshToken(ctx context.Context, token string) (RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	refreshToken, ok := s.refreshTokens[auth.HashRefreshToken(token)]
+	if !ok || refreshToken.TokenPrefix != auth.RefreshTokenPrefix(token) {
+		return RefreshToken{}, ErrNotFound
+	}
+	return refreshToken, nil
+}
+
+func (s *memoryStore) RotateRefreshToken(ctx context.Context, tokenHash, replacedBy string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token := s.refreshTokens[tokenHash]
+	if token.Replaced || token.Revoked {
+		return ErrRefreshTokenUsed
+	}
+	token.Replaced = true
+	s.refreshTokens[tokenHash] = token
+	return nil
+}
+
+func (s *memoryStore) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, token := range s.refreshTokens {
+		if token.FamilyID == familyID {
+			token.Revoked = true
+			s.refreshTokens[hash] = token
+		}
+	}
+	return nil
+}
+
+type testEnv struct {
+	store    *memoryStore
+	keys     *auth.Keyring
+	server   *httptest.Server
+	client   *http.Client
+	publicID uuid.UUID
+	secretID uuid.UUID
+	secret   string
+}
+
+const (
+	testRedirectURI = "https://app.example/callback"
+	testVerifier    = "dBjftJeZ4CVP-mJ92K2RXNMBY-ENuLMjRKyAhsGwjfStW4DZ"
+)
+
+func newTestEnv(t *testing.T) *testEnv {
+	keys, err := auth.NewKeyring([]auth.SigningKey{{ID: "test", Secret: []byte("superSecret")}})
+	if err != nil {
+		t.Fatalf("NewKeyring failed with: %v", err)
+	}
+	secret, err := MakeClientSecret()
+	if err != nil {
+		t.Fatalf("MakeClientSecret failed with: %v", err)
+	}
+	env := &testEnv{
+		keys:     keys,
+		publicID: uuid.New(),
+		secretID: uuid.New(),
+		secret:   secret,
+	}
+	env.store = &memoryStore{
+		clients: map[uuid.UUID]Client{
+			env.publicID: {
+				ID:           env.publicID,
+				Name:         "Chirp Scheduler",
+				RedirectURIs: []string{testRedirectURI},
+				Scopes:       []string{auth.ScopeChirpsRead, auth.ScopeChirpsWrite},
+			},
+			env.secretID: {
+				ID:           env.secretID,
+				Name:         "Chirp Analytics",
+				SecretHash:   HashSecret(secret),
+				RedirectURIs: []string{testRedirectURI},
+				Scopes:       []string{auth.ScopeChirpsRead},
+			},
+		},
+		userID:        uuid.New(),
+		email:         "walt@breakingbad.com",
+		password:      "04234",
+		codes:         map[string]AuthorizationCode{},
+		refreshTokens: map[string]RefreshToken{},
+	}
+
+	server := &Server{
+		Store:                env.store,
+		Keys:                 keys,
+		Audience:             "chirpy-api",
+		AccessTokenDuration:  time.Hour,
+		RefreshTokenDuration: 24 * time.Hour,
+		CodeDuration:         time.Minute,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /oauth/authorize", server.HandleAuthorize)
+	mux.HandleFunc("POST /oauth/authorize", server.HandleAuthorizeDecision)
+	mux.HandleFunc("POST /oauth/token", server.HandleToken)
+	mux.HandleFunc("POST /oauth/introspect", server.HandleIntrospect)
+	env.server = httptest.NewServer(mux)
+	t.Cleanup(env.server.Close)
+
+	// Redirects go to the third-party app, so stop at them like a client
+	// reading the Location header would.
+	env.client = env.server.Client()
+	env.client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return env
+}
+
+func (env *testEnv) authorizeParams(clientID uuid.UUID, scope string) url.Values {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {clientID.String()},
+		"redirect_uri":          {testRedirectURI},
+		"scope":                 {scope},
+		"state":                 {"xyz"},
+		"code_challenge":        {CodeChallengeS256(testVerifier)},
+		"code_challenge_method": {"S256"},
+	}
+}
+
+// authorize goes through the consent page and returns the redirect the user
+// ends up at.
+func (env *testEnv) authorize(t *testing.T, params url.Values, action string) *url.URL {
+	resp, err := env.client.Get(env.server.URL + "/oauth/authorize?" + params.Encode())
+	if err != nil {
+		t.Fatalf("GET /oauth/authorize failed with: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || !strings.Contains(string(body), "Authorize Chirp") {
+		t.Fatalf("unexpected consent page %v: %s", resp.StatusCode, body)
+	}
+
+	form := url.Values{}
+	for key, values := range params {
+		form[key] = values
+	}
+	form.Set("email", env.store.email)
+	form.Set("password", env.store.password)
+	form.Set("action", action)
+	resp, err = env.client.PostForm(env.server.URL+"/oauth/authorize", form)
+	if err != nil {
+		t.Fatalf("POST /oauth/authorize failed with: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected a redirect, got %v", resp.StatusCode)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("failed parsing the redirect: %v", err)
+	}
+	return location
+}
+
+func (env *testEnv) post(t *testing.T, path string, form url.Values) (int, map[string]any) {
+	resp, err := env.client.PostForm(env.server.URL+path, form)
+	if err != nil {
+		t.Fatalf("POST %v failed with: %v", path, err)
+	}
+	defer resp.Body.Close()
+	body := map[string]any{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("failed decoding the response of %v: %v", path, err)
+	}
+	return resp.StatusCode, body
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	env := newTestEnv(t)
+
+	location := env.authorize(t, env.authorizeParams(env.publicID, auth.ScopeChirpsWrite), "approve")
+	if location.Query().Get("state") != "xyz" || location.Query().Get("code") == "" {
+		t.Errorf("unexpected redirect: %v", location)
+		return
+	}
+	code := location.Query().Get("code")
+
+	exchange := url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {env.publicID.String()},
+		"redirect_uri":  {testRedirectURI},
+		"code":          {code},
+		"code_verifier": {testVerifier},
+	}
+	status, tokens := env.post(t, "/oauth/token", exchange)
+	if status != 200 {
+		t.Errorf("token exchange failed with %v: %v", status, tokens)
+		return
+	}
+	if tokens["scope"] != auth.ScopeChirpsWrite || tokens["token_type"] != "Bearer" {
+		t.Errorf("unexpected token response: %v", tokens)
+		return
+	}
+	claims, err := auth.ValidateJWTClaims(tokens["access_token"].(string), env.keys, auth.ValidationOptions{Audience: "chirpy-api"})
+	if err != nil {
+		t.Errorf("ValidateJWTClaims failed with: %v", err)
+		return
+	}
+	if claims.UserID != env.store.userID || claims.ClientID != env.publicID ||
+		!auth.HasScope(claims.Scopes, auth.ScopeChirpsWrite) || auth.HasScope(claims.Scopes, auth.ScopeChirpsRead) {
+		t.Errorf("unexpected claims: %+v", claims)
+		return
+	}
+
+	if status, body := env.post(t, "/oauth/token", exchange); status != 400 || body["error"] != "invalid_grant" {
+		t.Errorf("reused authorization code returned %v: %v", status, body)
+		return
+	}
+
+	refresh := url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {env.publicID.String()},
+		"refresh_token": {tokens["refresh_token"].(string)},
+	}
+	status, refreshed := env.post(t, "/oauth/token", refresh)
+	if status != 200 || refreshed["refresh_token"] == tokens["refresh_token"] {
+		t.Errorf("refresh failed with %v: %v", status, refreshed)
+		return
+	}
+
+	if status, body := env.post(t, "/oauth/token", refresh); status != 400 || body["error"] != "invalid_grant" {
+		t.Errorf("reused refresh token returned %v: %v", status, body)
+		return
+	}
+	refresh.Set("refresh_token", refreshed["refresh_token"].(string))
+	if status, body := env.post(t, "/oauth/token", refresh); status != 400 || body["error"] != "invalid_grant" {
+		t.Errorf("refresh token of a revoked family returned %v: %v", status, body)
+		return
+	}
+}
+
+func TestAuthorizationErrors(t *testing.T) {
+	env := newTestEnv(t)
+
+	location := env.authorize(t, env.authorizeParams(env.publicID, ""), "deny")
+	if location.Query().Get("error") != "access_denied" || location.Query().Get("state") != "xyz" {
+		t.Errorf("unexpected redirect: %v", location)
+		return
+	}
+
+	params := env.authorizeParams(env.secretID, auth.ScopeChirpsWrite)
+	resp, err := env.client.Get(env.server.URL + "/oauth/authorize?" + params.Encode())
+	if err != nil {
+		t.Fatalf("GET /oauth/authorize failed with: %v", err)
+	}
+	resp.Body.Close()
+	location, _ = url.Parse(resp.Header.Get("Location"))
+	if resp.StatusCode != http.StatusSeeOther || location.Query().Get("error") != "invalid_scope" {
+		t.Errorf("scope the client may not ask for returned %v %v", resp.StatusCode, location)
+		return
+	}
+
+	params.Set("redirect_uri", "https://evil.example/callback")
+	resp, err = env.client.Get(env.server.URL + "/oauth/authorize?" + params.Encode())
+	if err != nil {
+		t.Fatalf("GET /oauth/authorize failed with: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Errorf("unregistered redirect_uri returned %v", resp.StatusCode)
+		return
+	}
+
+	location = env.authorize(t, env.authorizeParams(env.publicID, ""), "approve")
+	status, body := env.post(t, "/oauth/token", url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {env.publicID.String()},
+		"redirect_uri":  {testRedirectURI},
+		"code":          {location.Query().Get("code")},
+		"code_verifier": {strings.Repeat("a", 43)},
+	})
+	if status != 400 || body["error"] != "invalid_grant" {
+		t.Errorf("wrong code_verifier returned %v: %v", status, body)
+		return
+	}
+}
+
+func TestIntrospection(t *testing.T) {
+	env := newTestEnv(t)
+
+	location := env.authorize(t, env.authorizeParams(env.secretID, ""), "approve")
+	exchange := url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {env.secretID.String()},
+		"redirect_uri":  {testRedirectURI},
+		"code":          {location.Query().Get("code")},
+		"code_verifier": {testVerifier},
+	}
+	if status, body := env.post(t, "/oauth/token", exchange); status != 401 || body["error"] != "invalid_client" {
+		t.Errorf("confidential client without its secret returned %v: %v", status, body)
+		return
+	}
+	exchange.Set("client_secret", env.secret)
+	status, tokens := env.post(t, "/oauth/token", exchange)
+	if status != 200 {
+		t.Errorf("token exchange failed with %v: %v", status, tokens)
+		return
+	}
+
+	cases := []struct {
+		Token     string
+		Active    bool
+		TokenType string
+	}{
+		{Token: tokens["access_token"].(string), Active: true, TokenType: "access_token"},
+		{Token: tokens["refresh_token"].(string), Active: true, TokenType: "refresh_token"},
+		{Token: "nonsense", Active: false},
+	}
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", i), func(t *testing.T) {
+			status, body := env.post(t, "/oauth/introspect", url.Values{
+				"client_id":     {env.secretID.String()},
+				"client_secret": {env.secret},
+				"token":         {c.Token},
+			})
+			if status != 200 || body["active"] != c.Active {
+				t.Errorf("introspection returned %v: %v", status, body)
+				return
+			}
+			if c.Active && (body["token_type"] != c.TokenType || body["sub"] != env.store.userID.String()) {
+				t.Errorf("unexpected introspection response: %v", body)
+				return
+			}
+		})
+	}
+}
@@ -0,0 +1,317 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/marekmchl/Chirpy/internal/auth"
+)
+
+// tokenError writes an error response as described in RFC 6749 section 5.2.
+func tokenError(w http.ResponseWriter, status int, code, description string) {
+	if status == 401 {
+		w.Header().Add("WWW-Authenticate", `Basic realm="chirpy"`)
+	}
+	writeJSON(w, status, map[string]string{"error": code, "error_description": description})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	bodyJson, err := json.Marshal(body)
+	if err != nil {
+		http.Error(w, "Failed marshalling the response body: "+err.Error(), 500)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Add("Cache-Control", "no-store")
+	w.Header().Add("Pragma", "no-cache")
+	w.WriteHeader(status)
+	w.Write(bodyJson)
+}
+
+// authenticateClient identifies the client from HTTP basic auth or the
+// client_id and client_secret form fields. Confidential clients must send
+// their secret.
+func (s *Server) authenticateClient(r *http.Request) (Client, bool, error) {
+	clientIDString, secret, ok := r.BasicAuth()
+	if !ok {
+		clientIDString = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+	clientID, err := uuid.Parse(clientIDString)
+	if err != nil {
+		return Client{}, false, nil
+	}
+	client, err := s.Store.GetClient(r.Context(), clientID)
+	if errors.Is(err, ErrNotFound) {
+		return Client{}, false, nil
+	}
+	if err != nil {
+		return Client{}, false, err
+	}
+	if client.Confidential() && !client.CheckSecret(secret) {
+		return Client{}, false, nil
+	}
+	return client, true, nil
+}
+
+// HandleToken exchanges authorization codes and refresh tokens for access
+// tokens.
+func (s *Server) HandleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, 400, "invalid_request", "failed parsing the form")
+		return
+	}
+	client, ok, err := s.authenticateClient(r)
+	if err != nil {
+		tokenError(w, 500, "server_error", err.Error())
+		return
+	}
+	if !ok {
+		tokenError(w, 401, "invalid_client", "client authentication failed")
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		s.exchangeAuthorizationCode(w, r, client)
+	case "refresh_token":
+		s.exchangeRefreshToken(w, r, client)
+	default:
+		tokenError(w, 400, "unsupported_grant_type", "only authorization_code and refresh_token are supported")
+	}
+}
+
+func (s *Server) exchangeAuthorizationCode(w http.ResponseWriter, r *http.Request, client Client) {
+	code, err := s.Store.ConsumeAuthorizationCode(r.Context(), HashSecret(r.PostForm.Get("code")))
+	if errors.Is(err, ErrNotFound) {
+		tokenError(w, 400, "invalid_grant", "invalid authorization code")
+		return
+	}
+	if err != nil {
+		tokenError(w, 500, "server_error", err.Error())
+		return
+	}
+	if code.ClientID != client.ID || code.ExpiresAt.Before(time.Now()) {
+		tokenError(w, 400, "invalid_grant", "invalid authorization code")
+		return
+	}
+	if code.RedirectURI != r.PostForm.Get("redirect_uri") {
+		tokenError(w, 400, "invalid_grant", "redirect_uri doesn't match the authorization request")
+		return
+	}
+	if !checkCodeVerifier(r.PostForm.Get("code_verifier"), code.CodeChallenge) {
+		tokenError(w, 400, "invalid_grant", "code_verifier doesn't match the code_challenge")
+		return
+	}
+	if !s.checkUser(r.Context(), w, code.UserID) {
+		return
+	}
+
+	s.issueTokens(r.Context(), w, RefreshToken{
+		FamilyID: uuid.New(),
+		UserID:   code.UserID,
+		ClientID: client.ID,
+		Scopes:   code.Scopes,
+	})
+}
+
+func (s *Server) exchangeRefreshToken(w http.ResponseWriter, r *http.Request, client Client) {
+	token := r.PostForm.Get("refresh_token")
+	oldToken, err := s.Store.GetRefreshToken(r.Context(), token)
+	if errors.Is(err, ErrNotFound) {
+		tokenError(w, 400, "invalid_grant", "invalid refresh token")
+		return
+	}
+	if err != nil {
+		tokenError(w, 500, "server_error", err.Error())
+		return
+	}
+	if oldToken.ClientID != client.ID || oldToken.Revoked || oldToken.ExpiresAt.Before(time.Now()) {
+		tokenError(w, 400, "invalid_grant", "invalid refresh token")
+		return
+	}
+
+	scopes := oldToken.Scopes
+	if requested := strings.Fields(r.PostForm.Get("scope")); len(requested) > 0 {
+		narrowed, err := auth.ParseScopes(requested)
+		if err != nil {
+			tokenError(w, 400, "invalid_scope", err.Error())
+			return
+		}
+		for _, scope := range narrowed {
+			if !slices.Contains(oldToken.Scopes, scope) {
+				tokenError(w, 400, "invalid_scope", "scope "+scope+" wasn't granted")
+				return
+			}
+		}
+		scopes = narrowed
+	}
+	if !s.checkUser(r.Context(), w, oldToken.UserID) {
+		return
+	}
+
+	newToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		tokenError(w, 500, "server_error", err.Error())
+		return
+	}
+	err = s.Store.RotateRefreshToken(r.Context(), oldToken.TokenHash, auth.HashRefreshToken(newToken))
+	if errors.Is(err, ErrRefreshTokenUsed) {
+		// A rotated token coming back means it was copied, so neither copy
+		// can be trusted any more.
+		if err := s.Store.RevokeRefreshTokenFamily(r.Context(), oldToken.FamilyID); err != nil {
+			tokenError(w, 500, "server_error", err.Error())
+			return
+		}
+		log.Printf("security: reused refresh token of client %v for user %v, revoked family %v", client.ID, oldToken.UserID, oldToken.FamilyID)
+		tokenError(w, 400, "invalid_grant", "invalid refresh token")
+		return
+	}
+	if err != nil {
+		tokenError(w, 500, "server_error", err.Error())
+		return
+	}
+
+	s.issueTokensWithRefreshToken(r.Context(), w, newToken, RefreshToken{
+		FamilyID: oldToken.FamilyID,
+		UserID:   oldToken.UserID,
+		ClientID: client.ID,
+		Scopes:   scopes,
+	})
+}
+
+func (s *Server) checkUser(ctx context.Context, w http.ResponseWriter, userID uuid.UUID) bool {
+	err := s.Store.CheckUser(ctx, userID)
+	if errors.Is(err, ErrAccountRestricted) {
+		tokenError(w, 400, "invalid_grant", err.Error())
+		return false
+	}
+	if err != nil {
+		tokenError(w, 500, "server_error", err.Error())
+		return false
+	}
+	return true
+}
+
+func (s *Server) issueTokens(ctx context.Context, w http.ResponseWriter, grant RefreshToken) {
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		tokenError(w, 500, "server_error", err.Error())
+		return
+	}
+	s.issueTokensWithRefreshToken(ctx, w, refreshToken, grant)
+}
+
+// issueTokensWithRefreshToken stores refreshToken for grant and responds
+// with it and a new access token.
+func (s *Server) issueTokensWithRefreshToken(ctx context.Context, w http.ResponseWriter, refreshToken string, grant RefreshToken) {
+	accessToken, err := auth.MakeClientJWT(grant.UserID, grant.ClientID, grant.Scopes, s.Keys, s.Audience, s.AccessTokenDuration)
+	if err != nil {
+		tokenError(w, 500, "server_error", err.Error())
+		return
+	}
+
+	grant.TokenHash = auth.HashRefreshToken(refreshToken)
+	grant.TokenPrefix = auth.RefreshTokenPrefix(refreshToken)
+	grant.ExpiresAt = time.Now().Add(s.RefreshTokenDuration)
+	if err := s.Store.CreateRefreshToken(ctx, grant); err != nil {
+		tokenError(w, 500, "server_error", err.Error())
+		return
+	}
+
+	writeJSON(w, 200, struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+		Scope        string `json:"scope"`
+	}{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.AccessTokenDuration.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        auth.FormatScopes(grant.Scopes),
+	})
+}
+
+type introspectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+}
+
+// HandleIntrospect tells a confidential client whether one of its access or
+// refresh tokens is still active. Tokens of other clients are reported as
+// inactive.
+func (s *Server) HandleIntrospect(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, 400, "invalid_request", "failed parsing the form")
+		return
+	}
+	client, ok, err := s.authenticateClient(r)
+	if err != nil {
+		tokenError(w, 500, "server_error", err.Error())
+		return
+	}
+	if !ok || !client.Confidential() {
+		tokenError(w, 401, "invalid_client", "client authentication failed")
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	claims, err := auth.ValidateJWTClaims(token, s.Keys, auth.ValidationOptions{
+		Audience:    s.Audience,
+		Revocations: s.Revocations,
+	})
+	if err == nil {
+		if claims.ClientID != client.ID || s.Store.CheckUser(r.Context(), claims.UserID) != nil {
+			writeJSON(w, 200, introspectionResponse{})
+			return
+		}
+		writeJSON(w, 200, introspectionResponse{
+			Active:    true,
+			Scope:     auth.FormatScopes(claims.Scopes),
+			ClientID:  client.ID.String(),
+			Subject:   claims.UserID.String(),
+			TokenType: "access_token",
+			IssuedAt:  claims.IssuedAt.Unix(),
+			ExpiresAt: claims.ExpiresAt.Unix(),
+		})
+		return
+	}
+
+	refreshToken, err := s.Store.GetRefreshToken(r.Context(), token)
+	if errors.Is(err, ErrNotFound) {
+		writeJSON(w, 200, introspectionResponse{})
+		return
+	}
+	if err != nil {
+		tokenError(w, 500, "server_error", err.Error())
+		return
+	}
+	if refreshToken.ClientID != client.ID || refreshToken.Revoked || refreshToken.Replaced ||
+		refreshToken.ExpiresAt.Before(time.Now()) || s.Store.CheckUser(r.Context(), refreshToken.UserID) != nil {
+		writeJSON(w, 200, introspectionResponse{})
+		return
+	}
+	writeJSON(w, 200, introspectionResponse{
+		Active:    true,
+		Scope:     auth.FormatScopes(refreshToken.Scopes),
+		ClientID:  client.ID.String(),
+		Subject:   refreshToken.UserID.String(),
+		TokenType: "refresh_token",
+		IssuedAt:  refreshToken.IssuedAt.Unix(),
+		ExpiresAt: refreshToken.ExpiresAt.Unix(),
+	})
+}
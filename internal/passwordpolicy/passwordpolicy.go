@@ -0,0 +1,213 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	RuleMinLength     = "min_length"
+	RuleMinEntropy    = "min_entropy"
+	RuleContainsEmail = "contains_email"
+	RuleBreached      = "breached"
+)
+
+// Violation is a rule a password failed, with a message meant for the user.
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Policy decides which passwords users may choose. Breached may be nil to
+// skip the breached password check.
+type Policy struct {
+	MinLength      int
+	MinEntropyBits float64
+	DisallowEmail  bool
+	Breached       *BreachedList
+}
+
+var DefaultPolicy = Policy{
+	MinLength:      8,
+	MinEntropyBits: 35,
+	DisallowEmail:  true,
+}
+
+// Check returns every rule password fails for the user with this email, or
+// nil if it is acceptable.
+func (p Policy) Check(password, email string) []Violation {
+	var violations []Violation
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, Violation{
+			Rule:    RuleMinLength,
+			Message: fmt.Sprintf("Password must be at least %d characters long", p.MinLength),
+		})
+	}
+	if EstimateEntropy(password) < p.MinEntropyBits {
+		violations = append(violations, Violation{
+			Rule:    RuleMinEntropy,
+			Message: "Password is too easy to guess, use a longer password with more kinds of characters",
+		})
+	}
+	if p.DisallowEmail && containsEmail(password, email) {
+		violations = append(violations, Violation{
+			Rule:    RuleContainsEmail,
+			Message: "Password must not contain your email address",
+		})
+	}
+	if p.Breached != nil && p.Breached.Contains(password) {
+		violations = append(violations, Violation{
+			Rule:    RuleBreached,
+			Message: "Password appeared in a data breach, choose a different one",
+		})
+	}
+	return violations
+}
+
+func containsEmail(password, email string) bool {
+	password = strings.ToLower(password)
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return false
+	}
+	if strings.Contains(password, email) {
+		return true
+	}
+	// short local parts like "jo" would match too many passwords
+	local, _, _ := strings.Cut(email, "@")
+	return len(local) >= 4 && strings.Contains(password, local)
+}
+
+// EstimateEntropy estimates the strength of password in bits from the
+// kinds of characters it uses. Characters repeating or continuing a run of
+// the previous one ("aaaa", "1234", "dcba") add nothing.
+func EstimateEntropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	length := 0
+	prev, step := rune(-1), rune(0)
+	for _, r := range password {
+		switch {
+		case r < unicode.MaxASCII && unicode.IsLower(r):
+			lower = true
+		case r < unicode.MaxASCII && unicode.IsUpper(r):
+			upper = true
+		case r < unicode.MaxASCII && unicode.IsDigit(r):
+			digit = true
+		case r < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+
+		diff := r - prev
+		if prev >= 0 && (diff == 0 || (diff == step && (diff == 1 || diff == -1))) {
+			prev = r
+			continue
+		}
+		if prev >= 0 && (diff == 1 || diff == -1) {
+			// the first step of a run still counts, it isn't a run yet
+			step = diff
+		} else {
+			step = 0
+		}
+		prev = r
+		length++
+	}
+
+	pool := 0
+	if lower {
+		pool += 26
+	}
+	if upper {
+		pool += 26
+	}
+	if digit {
+		pool += 10
+	}
+	if symbol {
+		pool += 33
+	}
+	if other {
+		pool += 100
+	}
+	if pool == 0 {
+		return 0
+	}
+	return float64(length) * math.Log2(float64(pool))
+}
+
+// BreachedList is a set of SHA-1 hashes of passwords known from data
+// breaches. It is safe for concurrent use and can be replaced at runtime
+// with SetHashes.
+type BreachedList struct {
+	mu     sync.RWMutex
+	hashes map[[sha1.Size]byte]struct{}
+}
+
+func NewBreachedList() *BreachedList {
+	return &BreachedList{hashes: map[[sha1.Size]byte]struct{}{}}
+}
+
+// LoadBreachedFile reads hex encoded SHA-1 hashes, one per line. A ":count"
+// suffix, as in the Have I Been Pwned downloads, is ignored, as are blank
+// lines and lines starting with '#'.
+func LoadBreachedFile(path string) ([][sha1.Size]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed opening breached password list: %v", err)
+	}
+	defer file.Close()
+
+	hashes := [][sha1.Size]byte{}
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hexHash, _, _ := strings.Cut(line, ":")
+		decoded, err := hex.DecodeString(hexHash)
+		if err != nil || len(decoded) != sha1.Size {
+			return nil, fmt.Errorf("invalid SHA-1 hash on line %d of breached password list", lineNumber)
+		}
+		hashes = append(hashes, [sha1.Size]byte(decoded))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed reading breached password list: %v", err)
+	}
+	return hashes, nil
+}
+
+func (l *BreachedList) SetHashes(hashes [][sha1.Size]byte) {
+	set := make(map[[sha1.Size]byte]struct{}, len(hashes))
+	for _, hash := range hashes {
+		set[hash] = struct{}{}
+	}
+	l.mu.Lock()
+	l.hashes = set
+	l.mu.Unlock()
+}
+
+func (l *BreachedList) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.hashes)
+}
+
+func (l *BreachedList) Contains(password string) bool {
+	hash := sha1.Sum([]byte(password))
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	_, ok := l.hashes[hash]
+	return ok
+}
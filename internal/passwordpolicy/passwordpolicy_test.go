@@ -0,0 +1,108 @@
+package passwordpolicy
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	breached := NewBreachedList()
+	breached.SetHashes([][sha1.Size]byte{sha1.Sum([]byte("hunter2hunter2"))})
+	policy := DefaultPolicy
+	policy.Breached = breached
+
+	cases := []struct {
+		Password string
+		Email    string
+		Expected []string
+	}{
+		{Password: "correct horse battery staple", Email: "walt@breakingbad.com", Expected: nil},
+		{Password: "", Email: "walt@breakingbad.com", Expected: []string{RuleMinLength, RuleMinEntropy}},
+		{Password: "Xy7!", Email: "walt@breakingbad.com", Expected: []string{RuleMinLength, RuleMinEntropy}},
+		{Password: "aaaaaaaaaaaaaaaa", Email: "walt@breakingbad.com", Expected: []string{RuleMinEntropy}},
+		{Password: "abcdefgh12345678", Email: "walt@breakingbad.com", Expected: []string{RuleMinEntropy}},
+		{Password: "heisenberg!Walt@BreakingBad.com", Email: "walt@breakingbad.com", Expected: []string{RuleContainsEmail}},
+		{Password: "saul goodman's lawyer", Email: "saul@breakingbad.com", Expected: []string{RuleContainsEmail}},
+		{Password: "hunter2hunter2", Email: "walt@breakingbad.com", Expected: []string{RuleBreached}},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", i), func(t *testing.T) {
+			var actual []string
+			for _, violation := range policy.Check(c.Password, c.Email) {
+				actual = append(actual, violation.Rule)
+			}
+			if !slices.Equal(actual, c.Expected) {
+				t.Errorf("Check(%q) failed %v, expected %v", c.Password, actual, c.Expected)
+				return
+			}
+		})
+	}
+}
+
+func TestEstimateEntropy(t *testing.T) {
+	cases := []struct {
+		Weaker   string
+		Stronger string
+	}{
+		{Weaker: "aaaaaaaa", Stronger: "abababab"},
+		{Weaker: "12345678", Stronger: "13572468"},
+		{Weaker: "zyxwvuts", Stronger: "zyxtuvws"},
+		{Weaker: "password", Stronger: "Password"},
+		{Weaker: "password", Stronger: "passwords"},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", i), func(t *testing.T) {
+			weaker, stronger := EstimateEntropy(c.Weaker), EstimateEntropy(c.Stronger)
+			if weaker >= stronger {
+				t.Errorf("EstimateEntropy(%q) = %v, not below EstimateEntropy(%q) = %v", c.Weaker, weaker, c.Stronger, stronger)
+				return
+			}
+		})
+	}
+
+	if EstimateEntropy("") != 0 {
+		t.Errorf("EstimateEntropy of the empty password isn't 0")
+		return
+	}
+}
+
+func TestLoadBreachedFile(t *testing.T) {
+	hash := sha1.Sum([]byte("password"))
+	content := "# top passwords\n" +
+		strings.ToUpper(fmt.Sprintf("%x", hash)) + ":9545824\n" +
+		"\n" +
+		fmt.Sprintf("%x", sha1.Sum([]byte("123456"))) + "\n"
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Errorf("failed writing the list: %v", err)
+		return
+	}
+
+	hashes, err := LoadBreachedFile(path)
+	if err != nil {
+		t.Errorf("LoadBreachedFile failed with: %v", err)
+		return
+	}
+	list := NewBreachedList()
+	list.SetHashes(hashes)
+	if list.Len() != 2 || !list.Contains("password") || !list.Contains("123456") || list.Contains("Password") {
+		t.Errorf("unexpected list contents: %v hashes", list.Len())
+		return
+	}
+
+	if err := os.WriteFile(path, []byte("not-a-hash\n"), 0o644); err != nil {
+		t.Errorf("failed writing the list: %v", err)
+		return
+	}
+	if _, err := LoadBreachedFile(path); err == nil {
+		t.Errorf("LoadBreachedFile accepted an invalid hash")
+		return
+	}
+}
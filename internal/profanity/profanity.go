@@ -0,0 +1,281 @@
+package profanity
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const mask = "****"
+
+const (
+	ActionMask   = "mask"
+	ActionReject = "reject"
+	ActionFlag   = "flag"
+)
+
+var DefaultWords = []string{"kerfuffle", "sharbert", "fornax"}
+
+type Entry struct {
+	Word     string
+	Action   string
+	Language string
+}
+
+// Result is the outcome of checking a text against the word list. Text has
+// the masked words replaced, Rejected and Flagged list the original words
+// that matched entries with those actions.
+type Result struct {
+	Text     string
+	Rejected []string
+	Flagged  []string
+}
+
+func IsValidAction(action string) bool {
+	return action == ActionMask || action == ActionReject || action == ActionFlag
+}
+
+// iOrL is what '1', '!' and '|' fold to, as they are used for both 'i' and
+// 'l'. Plain letters never fold to it, so "fall" doesn't match "fail";
+// instead blocked words are indexed under every spelling with iOrL in place
+// of their i's and l's.
+const iOrL = '1'
+
+// confusables maps look-alike runes (homoglyphs, accented letters and
+// leetspeak digits/symbols) onto the plain lowercase letter they imitate.
+// Plain ASCII letters are left alone.
+var confusables = map[rune]rune{
+	// leetspeak
+	'0': 'o', '!': iOrL, '|': iOrL, '3': 'e', '4': 'a', '@': 'a', '5': 's',
+	'$': 's', '7': 't', '+': 't', '8': 'b', '9': 'g',
+	// cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'к': 'k', 'м': 'm', 'н': 'h',
+	'о': 'o', 'р': 'p', 'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'і': 'i',
+	'ї': 'i', 'ј': 'j', 'ѕ': 's', 'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w',
+	// greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v',
+	'ο': 'o', 'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x',
+	// latin with diacritics
+	'à': 'a', 'á': 'a', 'â': 'a', 'ã': 'a', 'ä': 'a', 'å': 'a', 'ā': 'a',
+	'ç': 'c', 'ć': 'c', 'č': 'c', 'ď': 'd', 'è': 'e', 'é': 'e', 'ê': 'e',
+	'ë': 'e', 'ē': 'e', 'ě': 'e', 'ì': 'i', 'í': 'i', 'î': 'i', 'ï': 'i',
+	'ī': 'i', 'ı': 'i', 'ł': 'l', 'ñ': 'n', 'ń': 'n', 'ň': 'n', 'ò': 'o',
+	'ó': 'o', 'ô': 'o', 'õ': 'o', 'ö': 'o', 'ø': 'o', 'ō': 'o', 'ř': 'r',
+	'ś': 's', 'š': 's', 'ť': 't', 'ù': 'u', 'ú': 'u', 'û': 'u', 'ü': 'u',
+	'ū': 'u', 'ů': 'u', 'ý': 'y', 'ÿ': 'y', 'ź': 'z', 'ż': 'z', 'ž': 'z',
+}
+
+// Filter masks blocked words in text. It is safe for concurrent use and its
+// word list can be swapped at runtime with SetWords or SetEntries.
+type Filter struct {
+	mu    sync.RWMutex
+	words map[string]Entry
+	count int
+}
+
+func NewFilter(words []string) *Filter {
+	f := &Filter{}
+	f.SetWords(words)
+	return f
+}
+
+// LoadFile reads a word list with one word per line. Blank lines and lines
+// starting with '#' are ignored.
+func LoadFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed opening word list: %v", err)
+	}
+	defer file.Close()
+
+	words := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed reading word list: %v", err)
+	}
+	return words, nil
+}
+
+func (f *Filter) SetWords(words []string) {
+	entries := make([]Entry, 0, len(words))
+	for _, word := range words {
+		entries = append(entries, Entry{Word: word, Action: ActionMask})
+	}
+	f.SetEntries(entries)
+}
+
+// SetEntries replaces the word list. When two entries fold to the same
+// skeleton the stricter action wins.
+func (f *Filter) SetEntries(entries []Entry) {
+	skeletons := make(map[string]Entry, len(entries))
+	distinct := map[string]bool{}
+	for _, entry := range entries {
+		s := skeleton(entry.Word)
+		if s == "" {
+			continue
+		}
+		distinct[s] = true
+		for _, spelling := range spellings(s) {
+			if prev, ok := skeletons[spelling]; ok && severity(prev.Action) >= severity(entry.Action) {
+				continue
+			}
+			skeletons[spelling] = entry
+		}
+	}
+	f.mu.Lock()
+	f.words = skeletons
+	f.count = len(distinct)
+	f.mu.Unlock()
+}
+
+// Len returns how many distinct words are blocked.
+func (f *Filter) Len() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.count
+}
+
+// Replace masks every blocked word in s regardless of its action.
+func (f *Filter) Replace(s string) string {
+	return f.check(s, true).Text
+}
+
+// Check masks words with the mask action and reports the words that matched
+// reject or flag entries. Whitespace and punctuation around a matched word
+// are kept as they were.
+func (f *Filter) Check(s string) Result {
+	return f.check(s, false)
+}
+
+func (f *Filter) check(s string, maskAll bool) Result {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	result := Result{}
+	var b strings.Builder
+	b.Grow(len(s))
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			b.WriteRune(runes[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(runes) && !unicode.IsSpace(runes[j]) {
+			j++
+		}
+		token := runes[i:j]
+		i = j
+
+		entry, start, end, ok := f.match(token)
+		if !ok {
+			b.WriteString(string(token))
+			continue
+		}
+		switch {
+		case maskAll || entry.Action == ActionMask:
+			b.WriteString(string(token[:start]) + mask + string(token[end:]))
+			continue
+		case entry.Action == ActionReject:
+			result.Rejected = append(result.Rejected, string(token[start:end]))
+		case entry.Action == ActionFlag:
+			result.Flagged = append(result.Flagged, string(token[start:end]))
+		}
+		b.WriteString(string(token))
+	}
+	result.Text = b.String()
+	return result
+}
+
+// match finds the entry a token matches and the span of the token that
+// should be masked.
+func (f *Filter) match(token []rune) (Entry, int, int, bool) {
+	start, end := 0, len(token)
+	for start < end && isEdgePunct(token[start]) {
+		start++
+	}
+	for end > start && isEdgePunct(token[end-1]) {
+		end--
+	}
+	if entry, ok := f.words[skeleton(string(token[start:end]))]; ok && start < end {
+		return entry, start, end, true
+	}
+	// leetspeak symbols such as '$' or '@' look like punctuation, so the
+	// untrimmed token gets a second chance
+	if entry, ok := f.words[skeleton(string(token))]; ok {
+		return entry, 0, len(token), true
+	}
+	return Entry{}, 0, 0, false
+}
+
+func severity(action string) int {
+	switch action {
+	case ActionReject:
+		return 2
+	case ActionFlag:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func isEdgePunct(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
+
+// skeleton folds s into a canonical form so that visually or phonetically
+// equivalent spellings compare equal. Anything that doesn't fold to a letter
+// or digit is dropped.
+func skeleton(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		r = unicode.ToLower(r)
+		if r >= 'ａ' && r <= 'ｚ' {
+			r = r - 'ａ' + 'a'
+		}
+		if c, ok := confusables[r]; ok {
+			r = c
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// maxIOrL caps how many i's and l's of a word spellings varies, as the
+// spellings double with each.
+const maxIOrL = 8
+
+// spellings returns skeleton s with every combination of its i's and l's
+// replaced by iOrL.
+func spellings(s string) []string {
+	result := []string{""}
+	varied := 0
+	for _, r := range s {
+		vary := (r == 'i' || r == 'l') && varied < maxIOrL
+		if vary {
+			varied++
+		}
+		next := make([]string, 0, len(result)*2)
+		for _, prefix := range result {
+			next = append(next, prefix+string(r))
+			if vary {
+				next = append(next, prefix+string(iOrL))
+			}
+		}
+		result = next
+	}
+	return result
+}
@@ -0,0 +1,146 @@
+package profanity
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReplace(t *testing.T) {
+	cases := []struct {
+		Input    string
+		Expected string
+	}{
+		{
+			Input:    "I had something interesting for breakfast",
+			Expected: "I had something interesting for breakfast",
+		},
+		{
+			Input:    "I hear Mastodon is better than Chirpy. sharbert I need to migrate",
+			Expected: "I hear Mastodon is better than Chirpy. **** I need to migrate",
+		},
+		{
+			Input:    "What a Kerfuffle!",
+			Expected: "What a ****!",
+		},
+		{
+			Input:    "fornax, fornax and (FORNAX)",
+			Expected: "****, **** and (****)",
+		},
+		{
+			Input:    "k3rfuff1e and $harb3rt",
+			Expected: "**** and ****",
+		},
+		{
+			Input:    "fоrnах with cyrillic letters",
+			Expected: "**** with cyrillic letters",
+		},
+		{
+			Input:    "  keep\tthe   whitespace\n sharbert ",
+			Expected: "  keep\tthe   whitespace\n **** ",
+		},
+		{
+			Input:    "fornaxes are not fornax",
+			Expected: "fornaxes are not ****",
+		},
+	}
+
+	filter := NewFilter(DefaultWords)
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", i), func(t *testing.T) {
+			actual := filter.Replace(c.Input)
+			if actual != c.Expected {
+				t.Errorf("Replace(%q) = %q, expected %q", c.Input, actual, c.Expected)
+				return
+			}
+		})
+	}
+}
+
+func TestSetWords(t *testing.T) {
+	filter := NewFilter(DefaultWords)
+	filter.SetWords([]string{"gizmo"})
+
+	if actual := filter.Replace("kerfuffle gizmo"); actual != "kerfuffle ****" {
+		t.Errorf("reloaded filter returned %q", actual)
+		return
+	}
+}
+
+func TestReplaceKeepsLetters(t *testing.T) {
+	cases := []struct {
+		Input    string
+		Expected string
+	}{
+		{
+			Input:    "the tide may fall",
+			Expected: "the tide may fall",
+		},
+		{
+			Input:    "tides fail",
+			Expected: "tides ****",
+		},
+		{
+			Input:    "f4!l and fa1|",
+			Expected: "**** and ****",
+		},
+		{
+			Input:    "do not fai1",
+			Expected: "do not ****",
+		},
+	}
+
+	filter := NewFilter([]string{"fail"})
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", i), func(t *testing.T) {
+			actual := filter.Replace(c.Input)
+			if actual != c.Expected {
+				t.Errorf("Replace(%q) = %q, expected %q", c.Input, actual, c.Expected)
+				return
+			}
+		})
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "words.txt")
+	content := "# blocked words\nkerfuffle\n\n  sharbert  \n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed writing word list: %v", err)
+	}
+
+	words, err := LoadFile(path)
+	if err != nil {
+		t.Errorf("LoadFile failed with: %v", err)
+		return
+	}
+	if len(words) != 2 || words[0] != "kerfuffle" || words[1] != "sharbert" {
+		t.Errorf("unexpected words: %v", words)
+		return
+	}
+}
+
+func TestCheck(t *testing.T) {
+	filter := NewFilter(nil)
+	filter.SetEntries([]Entry{
+		{Word: "kerfuffle", Action: ActionMask},
+		{Word: "sharbert", Action: ActionReject},
+		{Word: "fornax", Action: ActionFlag},
+		{Word: "FORNAX", Action: ActionMask},
+	})
+
+	result := filter.Check("Kerfuffle! sharbert, fornax")
+	if result.Text != "****! sharbert, fornax" {
+		t.Errorf("unexpected text: %q", result.Text)
+		return
+	}
+	if len(result.Rejected) != 1 || result.Rejected[0] != "sharbert" {
+		t.Errorf("unexpected rejected words: %v", result.Rejected)
+		return
+	}
+	if len(result.Flagged) != 1 || result.Flagged[0] != "fornax" {
+		t.Errorf("unexpected flagged words: %v", result.Flagged)
+		return
+	}
+}
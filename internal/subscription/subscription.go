@@ -0,0 +1,94 @@
+package subscription
+
+import "time"
+
+const (
+	StatusActive    = "active"
+	StatusCancelled = "cancelled"
+	StatusExpired   = "expired"
+)
+
+// Events sent by Polka, the payment provider.
+const (
+	EventUpgraded   = "user.upgraded"
+	EventDowngraded = "user.downgraded"
+	EventRenewed    = "subscription.renewed"
+	EventCancelled  = "subscription.cancelled"
+)
+
+func IsEvent(name string) bool {
+	return name == EventUpgraded || name == EventDowngraded || name == EventRenewed || name == EventCancelled
+}
+
+// Event is a change to a subscription. PeriodEnd is zero when Polka didn't
+// say when the paid period ends.
+type Event struct {
+	Name      string
+	At        time.Time
+	PeriodEnd time.Time
+}
+
+// State is a Chirpy Red subscription. CancelledAt is zero unless it was
+// cancelled, LastEventAt is when the newest event applied to it happened.
+type State struct {
+	Status           string
+	StartedAt        time.Time
+	CurrentPeriodEnd time.Time
+	CancelledAt      time.Time
+	LastEventAt      time.Time
+}
+
+// IsMember reports whether the subscription makes its user a Chirpy Red
+// member at now. Cancelled subscriptions last until the paid period ends.
+func (s State) IsMember(now time.Time) bool {
+	return s.Status != StatusExpired && s.CurrentPeriodEnd.After(now)
+}
+
+// Apply returns the subscription after event, and whether it changed.
+// exists is false for users who never subscribed. Events older than the last
+// one applied are ignored, so a late delivery can't undo a newer change.
+//
+// Upgrades and renewals extend the paid period by period, from its current
+// end if it hasn't passed yet, unless the event says when the period ends.
+// A cancellation keeps membership until then and a downgrade ends it.
+func Apply(state State, exists bool, event Event, period time.Duration) (State, bool) {
+	if exists && event.At.Before(state.LastEventAt) {
+		return state, false
+	}
+	active := exists && state.Status != StatusExpired && !state.CurrentPeriodEnd.Before(event.At)
+
+	switch event.Name {
+	case EventUpgraded, EventRenewed:
+		if !active {
+			state.StartedAt = event.At
+		}
+		if !event.PeriodEnd.IsZero() {
+			state.CurrentPeriodEnd = event.PeriodEnd
+		} else if active {
+			state.CurrentPeriodEnd = state.CurrentPeriodEnd.Add(period)
+		} else {
+			state.CurrentPeriodEnd = event.At.Add(period)
+		}
+		state.Status = StatusActive
+		state.CancelledAt = time.Time{}
+	case EventCancelled:
+		if !exists || state.Status != StatusActive {
+			return state, false
+		}
+		state.Status = StatusCancelled
+		state.CancelledAt = event.At
+	case EventDowngraded:
+		if !exists {
+			state.StartedAt = event.At
+			state.CurrentPeriodEnd = event.At
+		}
+		if state.CurrentPeriodEnd.After(event.At) {
+			state.CurrentPeriodEnd = event.At
+		}
+		state.Status = StatusExpired
+	default:
+		return state, false
+	}
+	state.LastEventAt = event.At
+	return state, true
+}
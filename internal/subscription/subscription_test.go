@@ -0,0 +1,132 @@
+package subscription
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestApply(t *testing.T) {
+	period := 30 * 24 * time.Hour
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := func(n int) time.Time {
+		return start.Add(time.Duration(n) * 24 * time.Hour)
+	}
+	active := State{Status: StatusActive, StartedAt: day(0), CurrentPeriodEnd: day(30), LastEventAt: day(0)}
+
+	cases := []struct {
+		State           State
+		Exists          bool
+		Event           Event
+		Expected        State
+		ExpectedChanged bool
+	}{
+		{
+			// a new subscription
+			Event:           Event{Name: EventUpgraded, At: day(0)},
+			Expected:        active,
+			ExpectedChanged: true,
+		},
+		{
+			// an early renewal keeps the remaining days
+			State:  active,
+			Exists: true,
+			Event:  Event{Name: EventRenewed, At: day(25)},
+			Expected: State{
+				Status: StatusActive, StartedAt: day(0), CurrentPeriodEnd: day(60), LastEventAt: day(25),
+			},
+			ExpectedChanged: true,
+		},
+		{
+			// Polka's period end wins
+			State:  active,
+			Exists: true,
+			Event:  Event{Name: EventRenewed, At: day(30), PeriodEnd: day(61)},
+			Expected: State{
+				Status: StatusActive, StartedAt: day(0), CurrentPeriodEnd: day(61), LastEventAt: day(30),
+			},
+			ExpectedChanged: true,
+		},
+		{
+			// renewing a lapsed subscription starts it again
+			State:  State{Status: StatusExpired, StartedAt: day(0), CurrentPeriodEnd: day(30), LastEventAt: day(0)},
+			Exists: true,
+			Event:  Event{Name: EventRenewed, At: day(40)},
+			Expected: State{
+				Status: StatusActive, StartedAt: day(40), CurrentPeriodEnd: day(70), LastEventAt: day(40),
+			},
+			ExpectedChanged: true,
+		},
+		{
+			State:  active,
+			Exists: true,
+			Event:  Event{Name: EventCancelled, At: day(10)},
+			Expected: State{
+				Status: StatusCancelled, StartedAt: day(0), CurrentPeriodEnd: day(30), CancelledAt: day(10), LastEventAt: day(10),
+			},
+			ExpectedChanged: true,
+		},
+		{
+			// nothing to cancel
+			Event:           Event{Name: EventCancelled, At: day(10)},
+			Expected:        State{},
+			ExpectedChanged: false,
+		},
+		{
+			State:  active,
+			Exists: true,
+			Event:  Event{Name: EventDowngraded, At: day(10)},
+			Expected: State{
+				Status: StatusExpired, StartedAt: day(0), CurrentPeriodEnd: day(10), LastEventAt: day(10),
+			},
+			ExpectedChanged: true,
+		},
+		{
+			// an upgrade delivered after a newer downgrade is ignored
+			State:           State{Status: StatusExpired, StartedAt: day(0), CurrentPeriodEnd: day(10), LastEventAt: day(10)},
+			Exists:          true,
+			Event:           Event{Name: EventUpgraded, At: day(0)},
+			Expected:        State{Status: StatusExpired, StartedAt: day(0), CurrentPeriodEnd: day(10), LastEventAt: day(10)},
+			ExpectedChanged: false,
+		},
+		{
+			// a downgrade of someone who never subscribed still orders
+			// later events
+			Event:           Event{Name: EventDowngraded, At: day(5)},
+			Expected:        State{Status: StatusExpired, StartedAt: day(5), CurrentPeriodEnd: day(5), LastEventAt: day(5)},
+			ExpectedChanged: true,
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", i), func(t *testing.T) {
+			actual, changed := Apply(c.State, c.Exists, c.Event, period)
+			if actual != c.Expected || changed != c.ExpectedChanged {
+				t.Errorf("Apply(%+v, %+v) = %+v, %v, expected %+v, %v", c.State, c.Event, actual, changed, c.Expected, c.ExpectedChanged)
+				return
+			}
+		})
+	}
+}
+
+func TestIsMember(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		State    State
+		Expected bool
+	}{
+		{State: State{Status: StatusActive, CurrentPeriodEnd: now.Add(time.Hour)}, Expected: true},
+		{State: State{Status: StatusCancelled, CurrentPeriodEnd: now.Add(time.Hour)}, Expected: true},
+		{State: State{Status: StatusActive, CurrentPeriodEnd: now.Add(-time.Hour)}, Expected: false},
+		{State: State{Status: StatusExpired, CurrentPeriodEnd: now.Add(time.Hour)}, Expected: false},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", i), func(t *testing.T) {
+			if actual := c.State.IsMember(now); actual != c.Expected {
+				t.Errorf("IsMember(%+v) = %v, expected %v", c.State, actual, c.Expected)
+				return
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// Policy describes how failed attempts slow down further attempts. The
+// first FreeAttempts failures cost nothing, each one after that doubles the
+// wait from BaseDelay up to MaxDelay, and LockoutAfter failures lock out
+// for LockoutDuration. Failures are forgotten ResetAfter the last one.
+type Policy struct {
+	FreeAttempts    int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutAfter    int
+	LockoutDuration time.Duration
+	ResetAfter      time.Duration
+}
+
+// Delay returns how long after the last of failures consecutive failed
+// attempts the next attempt is allowed.
+func (p Policy) Delay(failures int) time.Duration {
+	if p.LockoutAfter > 0 && failures >= p.LockoutAfter {
+		return p.LockoutDuration
+	}
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// Locked reports whether failures is enough for a lockout rather than a
+// backoff.
+func (p Policy) Locked(failures int) bool {
+	return p.LockoutAfter > 0 && failures >= p.LockoutAfter
+}
+
+// Wait returns how much longer to wait after failures failed attempts, the
+// last at lastFailure, or 0 if an attempt is allowed at now.
+func (p Policy) Wait(failures int, lastFailure, now time.Time) time.Duration {
+	if failures == 0 || p.Expired(lastFailure, now) {
+		return 0
+	}
+	return max(lastFailure.Add(p.Delay(failures)).Sub(now), 0)
+}
+
+// Expired reports whether failures up to lastFailure are forgotten at now.
+func (p Policy) Expired(lastFailure, now time.Time) bool {
+	return p.ResetAfter > 0 && now.Sub(lastFailure) >= p.ResetAfter
+}
+
+type entry struct {
+	failures    int
+	lastFailure time.Time
+}
+
+// Tracker counts failed attempts per key in memory. It is safe for
+// concurrent use.
+type Tracker struct {
+	policy    Policy
+	mu        sync.Mutex
+	entries   map[string]entry
+	lastPrune time.Time
+}
+
+func NewTracker(policy Policy) *Tracker {
+	return &Tracker{
+		policy:  policy,
+		entries: map[string]entry{},
+	}
+}
+
+// Allow returns whether key may attempt at now, and if not how long it has
+// to wait.
+func (t *Tracker) Allow(key string, now time.Time) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e := t.entries[key]
+	wait := t.policy.Wait(e.failures, e.lastFailure, now)
+	return wait, wait == 0
+}
+
+// Failure records a failed attempt of key at now.
+func (t *Tracker) Failure(key string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.prune(now)
+	e := t.entries[key]
+	if t.policy.Expired(e.lastFailure, now) {
+		e.failures = 0
+	}
+	e.failures++
+	e.lastFailure = now
+	t.entries[key] = e
+}
+
+// Reset forgets the failed attempts of key.
+func (t *Tracker) Reset(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.entries, key)
+}
+
+func (t *Tracker) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.entries)
+}
+
+// prune drops expired entries, at most once per ResetAfter so it doesn't
+// run on every failure.
+func (t *Tracker) prune(now time.Time) {
+	if t.policy.ResetAfter <= 0 || now.Sub(t.lastPrune) < t.policy.ResetAfter {
+		return
+	}
+	for key, e := range t.entries {
+		if t.policy.Expired(e.lastFailure, now) {
+			delete(t.entries, key)
+		}
+	}
+	t.lastPrune = now
+}
@@ -0,0 +1,98 @@
+package throttle
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{
+	FreeAttempts:    3,
+	BaseDelay:       time.Second,
+	MaxDelay:        10 * time.Second,
+	LockoutAfter:    10,
+	LockoutDuration: 15 * time.Minute,
+	ResetAfter:      time.Hour,
+}
+
+func TestDelay(t *testing.T) {
+	cases := []struct {
+		Failures int
+		Expected time.Duration
+	}{
+		{Failures: 0, Expected: 0},
+		{Failures: 3, Expected: 0},
+		{Failures: 4, Expected: time.Second},
+		{Failures: 5, Expected: 2 * time.Second},
+		{Failures: 7, Expected: 8 * time.Second},
+		{Failures: 8, Expected: 10 * time.Second},
+		{Failures: 9, Expected: 10 * time.Second},
+		{Failures: 10, Expected: 15 * time.Minute},
+		{Failures: 1000, Expected: 15 * time.Minute},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", i), func(t *testing.T) {
+			actual := testPolicy.Delay(c.Failures)
+			if actual != c.Expected {
+				t.Errorf("Delay(%v) = %v, expected %v", c.Failures, actual, c.Expected)
+				return
+			}
+			if testPolicy.Locked(c.Failures) != (c.Failures >= 10) {
+				t.Errorf("Locked(%v) = %v", c.Failures, testPolicy.Locked(c.Failures))
+				return
+			}
+		})
+	}
+}
+
+func TestTracker(t *testing.T) {
+	tracker := NewTracker(testPolicy)
+	now := time.Unix(1700000000, 0)
+
+	for range 4 {
+		if _, ok := tracker.Allow("10.0.0.1", now); !ok {
+			t.Errorf("Allow refused an attempt within the free attempts")
+			return
+		}
+		tracker.Failure("10.0.0.1", now)
+	}
+	wait, ok := tracker.Allow("10.0.0.1", now.Add(200*time.Millisecond))
+	if ok || wait != 800*time.Millisecond {
+		t.Errorf("Allow after backoff = %v, %v", wait, ok)
+		return
+	}
+	if _, ok := tracker.Allow("10.0.0.2", now); !ok {
+		t.Errorf("Allow refused a different key")
+		return
+	}
+	if _, ok := tracker.Allow("10.0.0.1", now.Add(time.Second)); !ok {
+		t.Errorf("Allow refused an attempt after the backoff")
+		return
+	}
+
+	later := now.Add(2 * time.Hour)
+	tracker.Failure("10.0.0.2", later)
+	if tracker.Len() != 1 {
+		t.Errorf("Failure didn't prune expired entries, %v left", tracker.Len())
+		return
+	}
+	tracker.Failure("10.0.0.1", later)
+	if _, ok := tracker.Allow("10.0.0.1", later); !ok {
+		t.Errorf("expired failures still count")
+		return
+	}
+
+	for range 10 {
+		tracker.Failure("10.0.0.3", later)
+	}
+	if wait, ok := tracker.Allow("10.0.0.3", later.Add(time.Minute)); ok || wait != 14*time.Minute {
+		t.Errorf("Allow during lockout = %v, %v", wait, ok)
+		return
+	}
+	tracker.Reset("10.0.0.3")
+	if _, ok := tracker.Allow("10.0.0.3", later); !ok {
+		t.Errorf("Allow refused after Reset")
+		return
+	}
+}
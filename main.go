@@ -1,23 +1,57 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
 	"sync/atomic"
+	"syscall"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
+	"github.com/marekmchl/Chirpy/internal/auth"
 	"github.com/marekmchl/Chirpy/internal/database"
+	"github.com/marekmchl/Chirpy/internal/mail"
+	"github.com/marekmchl/Chirpy/internal/moderation"
+	"github.com/marekmchl/Chirpy/internal/oauth"
+	"github.com/marekmchl/Chirpy/internal/passwordpolicy"
+	"github.com/marekmchl/Chirpy/internal/profanity"
+	"github.com/marekmchl/Chirpy/internal/throttle"
 )
 
 type apiConfig struct {
-	fileserverHits atomic.Int32
-	db             *database.Queries
-	platform       string
-	secret         string
-	polkaKey       string
+	fileserverHits             atomic.Int32
+	db                         *database.Queries
+	sqlDB                      *sql.DB
+	platform                   string
+	secret                     string
+	signingKeysFile            string
+	keys                       *auth.Keyring
+	jwtAudience                string
+	jwtLeeway                  time.Duration
+	polkaKey                   string
+	profanityFile              string
+	profanity                  *profanity.Filter
+	moderation                 *moderation.Pipeline
+	hideSuspendedChirps        bool
+	revocations                *auth.RevocationList
+	oauth                      *oauth.Server
+	passwordPolicy             passwordpolicy.Policy
+	accountLoginPolicy         throttle.Policy
+	ipLoginThrottle            *throttle.Tracker
+	passwordResetThrottle      *throttle.Tracker
+	mailer                     mail.Mailer
+	baseURL                    string
+	accountDeletionGracePeriod time.Duration
 }
 
 func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
@@ -27,29 +61,404 @@ func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
 	})
 }
 
+type contextKey string
+
+const (
+	claimsContextKey contextKey = "claims"
+	userContextKey   contextKey = "user"
+)
+
+// middlewareAuth rejects requests without a valid, unrevoked access token
+// of a login session or whose user is banned or suspended, and passes the
+// token's claims on in the context.
+func (cfg *apiConfig) middlewareAuth(next http.Handler) http.Handler {
+	return cfg.middlewareScope("", next)
+}
+
+// middlewareScope works like middlewareAuth but also accepts personal access
+// tokens that carry scope.
+func (cfg *apiConfig) middlewareScope(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqToken, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(401)
+			w.Write(fmt.Appendf([]byte{}, "Failed getting token: %v", err))
+			return
+		}
+		var claims auth.TokenClaims
+		if auth.IsPersonalAccessToken(reqToken) {
+			claims, err = cfg.validatePersonalAccessToken(r.Context(), reqToken)
+		} else {
+			claims, err = auth.ValidateJWTClaims(reqToken, cfg.keys, auth.ValidationOptions{
+				Audience:    cfg.jwtAudience,
+				Leeway:      cfg.jwtLeeway,
+				Revocations: cfg.revocations,
+			})
+		}
+		if err != nil {
+			w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+			w.Header().Add("WWW-Authenticate", `Bearer error="invalid_token"`)
+			w.WriteHeader(401)
+			w.Write([]byte(tokenErrorMessage(err)))
+			return
+		}
+		if claims.Scopes != nil {
+			if scope == "" {
+				w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+				w.WriteHeader(403)
+				w.Write([]byte("Personal access tokens can't be used here"))
+				return
+			}
+			if !auth.HasScope(claims.Scopes, scope) {
+				w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+				w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%v"`, scope))
+				w.WriteHeader(403)
+				w.Write(fmt.Appendf([]byte{}, "Token lacks the %v scope", scope))
+				return
+			}
+		}
+		user, err := cfg.db.GetUserByID(r.Context(), claims.UserID)
+		if err != nil {
+			w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(401)
+			w.Write(fmt.Appendf([]byte{}, "Token invalid"))
+			return
+		}
+		if restriction := accountRestriction(user.Banned, user.SuspendedUntil); restriction != "" {
+			w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(403)
+			w.Write([]byte(restriction))
+			return
+		}
+		// sessions are revoked when deletion is requested, this stops
+		// personal access tokens
+		if user.DeletionRequestedAt.Valid {
+			w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(403)
+			w.Write([]byte("Account is scheduled for deletion, log in to cancel"))
+			return
+		}
+		ctx := context.WithValue(r.Context(), claimsContextKey, claims)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, userContextKey, user)))
+	})
+}
+
+// middlewarePublicScope lets anonymous requests through and only checks the
+// token, like middlewareScope, when one is sent.
+func (cfg *apiConfig) middlewarePublicScope(scope string, next http.Handler) http.Handler {
+	withScope := cfg.middlewareScope(scope, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		withScope.ServeHTTP(w, r)
+	})
+}
+
+// tokenErrorMessage tells clients why their access token was rejected
+// without echoing the parser's details.
+func tokenErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, auth.ErrTokenExpired):
+		return "Token expired"
+	case errors.Is(err, auth.ErrTokenRevoked):
+		return "Token revoked"
+	case errors.Is(err, auth.ErrTokenMalformed):
+		return "Token malformed"
+	case errors.Is(err, auth.ErrTokenSignatureInvalid):
+		return "Token signature invalid"
+	default:
+		return "Token invalid"
+	}
+}
+
+// middlewareRole only lets through authenticated users who currently have
+// role or a higher one. The role comes from the database rather than the
+// token, so demotions apply right away.
+func (cfg *apiConfig) middlewareRole(role string, next http.Handler) http.Handler {
+	return cfg.middlewareAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !auth.HasRole(roleFromContext(r.Context()), role) {
+			w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(403)
+			w.Write([]byte("Forbidden"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// claimsFromContext returns the access token claims of the user
+// authenticated by middlewareAuth.
+func claimsFromContext(ctx context.Context) auth.TokenClaims {
+	claims, _ := ctx.Value(claimsContextKey).(auth.TokenClaims)
+	return claims
+}
+
+func userIDFromContext(ctx context.Context) uuid.UUID {
+	return claimsFromContext(ctx).UserID
+}
+
+// userFromContext returns the database row of the user authenticated by
+// middlewareAuth, as loaded for the request.
+func userFromContext(ctx context.Context) database.User {
+	user, _ := ctx.Value(userContextKey).(database.User)
+	return user
+}
+
+func roleFromContext(ctx context.Context) string {
+	return userFromContext(ctx).Role
+}
+
+// accountRestriction explains why a user isn't allowed to use their account,
+// or returns "" if they are.
+func accountRestriction(banned bool, suspendedUntil sql.NullTime) string {
+	if banned {
+		return "Account banned"
+	}
+	if suspendedUntil.Valid && suspendedUntil.Time.After(time.Now()) {
+		return fmt.Sprintf("Account suspended until %v", suspendedUntil.Time.UTC().Format(time.RFC3339))
+	}
+	return ""
+}
+
 func getConfig() *apiConfig {
 	godotenv.Load(".env")
 	dbURL := os.Getenv("DB_URL")
 	pltfrm := os.Getenv("PLATFORM")
 	secret := os.Getenv("SECRET")
+	signingKeysFile := os.Getenv("SIGNING_KEYS_FILE")
+	jwtAudience := os.Getenv("JWT_AUDIENCE")
+	if jwtAudience == "" {
+		jwtAudience = "chirpy-api"
+	}
+	jwtLeeway := time.Duration(0)
+	if leeway := os.Getenv("JWT_LEEWAY"); leeway != "" {
+		parsed, err := time.ParseDuration(leeway)
+		if err != nil {
+			log.Fatalf("failed - invalid JWT_LEEWAY: %v", err)
+		}
+		jwtLeeway = parsed
+	}
+	if params := os.Getenv("PASSWORD_HASH_PARAMS"); params != "" {
+		parsed, err := auth.ParsePasswordParams(params)
+		if err != nil {
+			log.Fatalf("failed - invalid PASSWORD_HASH_PARAMS: %v", err)
+		}
+		if err := auth.SetPasswordParams(parsed); err != nil {
+			log.Fatalf("failed - invalid PASSWORD_HASH_PARAMS: %v", err)
+		}
+	}
+	passwordPolicy := passwordpolicy.DefaultPolicy
+	if minLength := os.Getenv("PASSWORD_MIN_LENGTH"); minLength != "" {
+		parsed, err := strconv.Atoi(minLength)
+		if err != nil {
+			log.Fatalf("failed - invalid PASSWORD_MIN_LENGTH: %v", err)
+		}
+		passwordPolicy.MinLength = parsed
+	}
+	if minEntropy := os.Getenv("PASSWORD_MIN_ENTROPY"); minEntropy != "" {
+		parsed, err := strconv.ParseFloat(minEntropy, 64)
+		if err != nil {
+			log.Fatalf("failed - invalid PASSWORD_MIN_ENTROPY: %v", err)
+		}
+		passwordPolicy.MinEntropyBits = parsed
+	}
+	passwordPolicy.DisallowEmail = os.Getenv("PASSWORD_ALLOW_EMAIL") != "true"
+	if breachedFile := os.Getenv("BREACHED_PASSWORDS_FILE"); breachedFile != "" {
+		hashes, err := passwordpolicy.LoadBreachedFile(breachedFile)
+		if err != nil {
+			log.Fatalf("failed - %v", err)
+		}
+		passwordPolicy.Breached = passwordpolicy.NewBreachedList()
+		passwordPolicy.Breached.SetHashes(hashes)
+	}
+	accountLoginPolicy := defaultAccountLoginPolicy
+	if attempts := os.Getenv("LOGIN_LOCKOUT_ATTEMPTS"); attempts != "" {
+		parsed, err := strconv.Atoi(attempts)
+		if err != nil {
+			log.Fatalf("failed - invalid LOGIN_LOCKOUT_ATTEMPTS: %v", err)
+		}
+		accountLoginPolicy.LockoutAfter = parsed
+	}
+	if duration := os.Getenv("LOGIN_LOCKOUT_DURATION"); duration != "" {
+		parsed, err := time.ParseDuration(duration)
+		if err != nil {
+			log.Fatalf("failed - invalid LOGIN_LOCKOUT_DURATION: %v", err)
+		}
+		accountLoginPolicy.LockoutDuration = parsed
+	}
+	baseURL := strings.TrimSuffix(os.Getenv("BASE_URL"), "/")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+	mailer, err := newMailer()
+	if err != nil {
+		log.Fatalf("failed - %v", err)
+	}
+	accountDeletionGracePeriod := defaultAccountDeletionGracePeriod
+	if gracePeriod := os.Getenv("ACCOUNT_DELETION_GRACE_PERIOD"); gracePeriod != "" {
+		parsed, err := time.ParseDuration(gracePeriod)
+		if err != nil {
+			log.Fatalf("failed - invalid ACCOUNT_DELETION_GRACE_PERIOD: %v", err)
+		}
+		accountDeletionGracePeriod = parsed
+	}
 	polkaKey := os.Getenv("POLKA_KEY")
+	profanityFile := os.Getenv("PROFANITY_FILE")
+	blockedDomains := strings.Split(os.Getenv("BLOCKED_DOMAINS"), ",")
+	hideSuspendedChirps := os.Getenv("HIDE_SUSPENDED_CHIRPS") == "true"
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
 		log.Fatalf("failed - %v", err)
 	}
 	dbQueries := database.New(db)
 	cfg := &apiConfig{
-		db:       dbQueries,
-		platform: pltfrm,
-		secret:   secret,
-		polkaKey: polkaKey,
+		db:                         dbQueries,
+		sqlDB:                      db,
+		platform:                   pltfrm,
+		secret:                     secret,
+		signingKeysFile:            signingKeysFile,
+		keys:                       &auth.Keyring{},
+		jwtAudience:                jwtAudience,
+		jwtLeeway:                  jwtLeeway,
+		polkaKey:                   polkaKey,
+		profanityFile:              profanityFile,
+		profanity:                  profanity.NewFilter(profanity.DefaultWords),
+		hideSuspendedChirps:        hideSuspendedChirps,
+		revocations:                auth.NewRevocationList(),
+		passwordPolicy:             passwordPolicy,
+		accountLoginPolicy:         accountLoginPolicy,
+		ipLoginThrottle:            throttle.NewTracker(defaultIPLoginPolicy),
+		passwordResetThrottle:      throttle.NewTracker(defaultPasswordResetPolicy),
+		mailer:                     mailer,
+		baseURL:                    baseURL,
+		accountDeletionGracePeriod: accountDeletionGracePeriod,
 	}
+	if err := cfg.loadSigningKeys(); err != nil {
+		log.Fatalf("failed - %v", err)
+	}
+	if err := cfg.loadProfanityWords(context.Background()); err != nil {
+		log.Fatalf("failed - %v", err)
+	}
+	if err := cfg.loadRevocations(context.Background()); err != nil {
+		log.Fatalf("failed - %v", err)
+	}
+	if adminEmail := os.Getenv("ADMIN_EMAIL"); adminEmail != "" {
+		if err := cfg.promoteAdmin(context.Background(), adminEmail); err != nil {
+			log.Fatalf("failed - %v", err)
+		}
+	}
+	cfg.oauth = &oauth.Server{
+		Store:                oauthStore{db: dbQueries, loginPolicy: accountLoginPolicy, ipThrottle: cfg.ipLoginThrottle},
+		Keys:                 cfg.keys,
+		Audience:             jwtAudience,
+		Revocations:          cfg.revocations,
+		AccessTokenDuration:  time.Duration(1 * time.Hour),
+		RefreshTokenDuration: refreshTokenDuration,
+		CodeDuration:         time.Duration(10 * time.Minute),
+	}
+	cfg.moderation = moderation.NewPipeline(
+		moderation.WordListStage{Filter: cfg.profanity},
+		moderation.LinkBlocklistStage{Domains: blockedDomains},
+		moderation.RepeatedCharactersStage{MaxRun: 10},
+	)
 	cfg.fileserverHits.Store(0)
 	return cfg
 }
 
+// loadSigningKeys (re)loads the access token signing keys from
+// SIGNING_KEYS_FILE, or uses SECRET as the only HS256 key if it isn't set.
+func (cfg *apiConfig) loadSigningKeys() error {
+	if cfg.signingKeysFile == "" {
+		return cfg.keys.SetKeys([]auth.SigningKey{{ID: "default", Secret: []byte(cfg.secret)}})
+	}
+	keys, err := auth.LoadKeyFile(cfg.signingKeysFile)
+	if err != nil {
+		return err
+	}
+	return cfg.keys.SetKeys(keys)
+}
+
+// reloadSigningKeysOnHangup reloads the signing keys whenever the process
+// receives SIGHUP. A key file that fails to load leaves the old keys in use.
+func (cfg *apiConfig) reloadSigningKeysOnHangup() {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	go func() {
+		for range hangups {
+			if err := cfg.loadSigningKeys(); err != nil {
+				log.Printf("failed reloading signing keys: %v", err)
+				continue
+			}
+			log.Printf("reloaded signing keys, active key %v", cfg.keys.ActiveKey().ID)
+		}
+	}()
+}
+
+// loadProfanityWords rebuilds the profanity filter from the moderation_words
+// table plus the optional PROFANITY_FILE, whose words are always masked.
+func (cfg *apiConfig) loadProfanityWords(ctx context.Context) error {
+	entries := []profanity.Entry{}
+	if cfg.profanityFile != "" {
+		words, err := profanity.LoadFile(cfg.profanityFile)
+		if err != nil {
+			return err
+		}
+		for _, word := range words {
+			entries = append(entries, profanity.Entry{Word: word, Action: profanity.ActionMask})
+		}
+	}
+
+	dbWords, err := cfg.db.GetAllModerationWords(ctx)
+	if err != nil {
+		return fmt.Errorf("failed getting moderation words: %v", err)
+	}
+	for _, dbWord := range dbWords {
+		entries = append(entries, profanity.Entry{
+			Word:     dbWord.Word,
+			Action:   dbWord.Action,
+			Language: dbWord.Language.String,
+		})
+	}
+
+	cfg.profanity.SetEntries(entries)
+	return nil
+}
+
+// newMailer sends mail through SMTP_ADDR if it is set and otherwise writes
+// it to MAIL_LOG_FILE, or stdout.
+func newMailer() (mail.Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Chirpy <no-reply@chirpy.local>"
+	}
+	if addr := os.Getenv("SMTP_ADDR"); addr != "" {
+		return mail.SMTPMailer{
+			Addr:     addr,
+			From:     from,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}, nil
+	}
+	logFile := os.Getenv("MAIL_LOG_FILE")
+	if logFile == "" {
+		return &mail.LogMailer{From: from, Writer: os.Stdout}, nil
+	}
+	file, err := os.OpenFile(logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed opening the mail log: %v", err)
+	}
+	return &mail.LogMailer{From: from, Writer: file}, nil
+}
+
 func main() {
 	cfg := getConfig()
+	cfg.reloadSigningKeysOnHangup()
+	cfg.deleteAccountsPeriodically()
+	cfg.deleteDataExportsPeriodically()
+	cfg.expireSubscriptionsPeriodically()
 
 	serveMux := http.ServeMux{}
 	serveMux.Handle("/app/", cfg.middlewareMetricsInc(http.StripPrefix("/app/", http.FileServer(http.Dir(".")))))
@@ -58,18 +467,69 @@ func main() {
 		w.WriteHeader(200)
 		w.Write([]byte{'O', 'K'})
 	})
-	serveMux.HandleFunc("GET /admin/metrics", cfg.handlerGetMetrics)
-	serveMux.HandleFunc("POST /admin/reset", cfg.handlerResetMetrics)
+	serveMux.HandleFunc("GET /.well-known/jwks.json", cfg.handlerGetJWKS)
+	serveMux.Handle("GET /admin/metrics", cfg.middlewareRole(auth.RoleAdmin, http.HandlerFunc(cfg.handlerGetMetrics)))
+	serveMux.Handle("POST /admin/reset", cfg.middlewareRole(auth.RoleAdmin, http.HandlerFunc(cfg.handlerResetMetrics)))
+	serveMux.Handle("POST /admin/profanity/reload", cfg.middlewareRole(auth.RoleModerator, http.HandlerFunc(cfg.handlerReloadProfanity)))
+	serveMux.Handle("GET /admin/moderation/words", cfg.middlewareRole(auth.RoleModerator, http.HandlerFunc(cfg.handlerGetModerationWords)))
+	serveMux.Handle("POST /admin/moderation/words", cfg.middlewareRole(auth.RoleModerator, http.HandlerFunc(cfg.handlerAddModerationWord)))
+	serveMux.Handle("DELETE /admin/moderation/words/{wordID}", cfg.middlewareRole(auth.RoleModerator, http.HandlerFunc(cfg.handlerDeleteModerationWord)))
+	serveMux.Handle("POST /admin/moderation/words/import", cfg.middlewareRole(auth.RoleModerator, http.HandlerFunc(cfg.handlerImportModerationWords)))
+	serveMux.Handle("GET /admin/moderation/reports", cfg.middlewareRole(auth.RoleModerator, http.HandlerFunc(cfg.handlerGetReports)))
+	serveMux.Handle("POST /admin/moderation/reports/{reportID}/claim", cfg.middlewareRole(auth.RoleModerator, http.HandlerFunc(cfg.handlerClaimReport)))
+	serveMux.Handle("POST /admin/moderation/reports/{reportID}/resolve", cfg.middlewareRole(auth.RoleModerator, http.HandlerFunc(cfg.handlerResolveReport)))
+	serveMux.Handle("GET /admin/moderation/chirps", cfg.middlewareRole(auth.RoleModerator, http.HandlerFunc(cfg.handlerGetHeldChirps)))
+	serveMux.Handle("POST /admin/moderation/chirps/{chirpID}/approve", cfg.middlewareRole(auth.RoleModerator, http.HandlerFunc(cfg.handlerApproveHeldChirp)))
+	serveMux.Handle("POST /admin/moderation/chirps/{chirpID}/reject", cfg.middlewareRole(auth.RoleModerator, http.HandlerFunc(cfg.handlerRejectHeldChirp)))
+	serveMux.Handle("GET /admin/moderation/actions", cfg.middlewareRole(auth.RoleModerator, http.HandlerFunc(cfg.handlerGetModerationActions)))
+	serveMux.Handle("POST /admin/users/{userID}/suspend", cfg.middlewareRole(auth.RoleModerator, http.HandlerFunc(cfg.handlerSuspendUser)))
+	serveMux.Handle("DELETE /admin/users/{userID}/suspend", cfg.middlewareRole(auth.RoleModerator, http.HandlerFunc(cfg.handlerUnsuspendUser)))
+	serveMux.Handle("POST /admin/users/{userID}/ban", cfg.middlewareRole(auth.RoleAdmin, http.HandlerFunc(cfg.handlerBanUser)))
+	serveMux.Handle("DELETE /admin/users/{userID}/ban", cfg.middlewareRole(auth.RoleAdmin, http.HandlerFunc(cfg.handlerUnbanUser)))
+	serveMux.Handle("POST /admin/users/{userID}/unlock", cfg.middlewareRole(auth.RoleAdmin, http.HandlerFunc(cfg.handlerUnlockUser)))
+	serveMux.Handle("PUT /admin/users/{userID}/role", cfg.middlewareRole(auth.RoleAdmin, http.HandlerFunc(cfg.handlerSetUserRole)))
 	serveMux.HandleFunc("POST /api/users", cfg.handlerCreateUser)
-	serveMux.HandleFunc("POST /api/chirps", cfg.handlerCreateChirp)
-	serveMux.HandleFunc("GET /api/chirps", cfg.handlerGetAllChirps)
-	serveMux.HandleFunc("GET /api/chirps/{chirpID}", cfg.handlerGetChirp)
+	serveMux.HandleFunc("GET /api/users/verify", cfg.handlerVerifyEmail)
+	serveMux.Handle("POST /api/users/verify", cfg.middlewareAuth(http.HandlerFunc(cfg.handlerResendVerificationEmail)))
+	serveMux.Handle("POST /api/chirps", cfg.middlewareScope(auth.ScopeChirpsWrite, http.HandlerFunc(cfg.handlerCreateChirp)))
+	serveMux.Handle("GET /api/chirps", cfg.middlewarePublicScope(auth.ScopeChirpsRead, http.HandlerFunc(cfg.handlerGetAllChirps)))
+	serveMux.Handle("GET /api/chirps/{chirpID}", cfg.middlewarePublicScope(auth.ScopeChirpsRead, http.HandlerFunc(cfg.handlerGetChirp)))
 	serveMux.HandleFunc("POST /api/login", cfg.handlerLogin)
+	serveMux.HandleFunc("POST /api/login/2fa", cfg.handlerLoginTwoFactor)
 	serveMux.HandleFunc("POST /api/refresh", cfg.handlerRefresh)
+	serveMux.HandleFunc("POST /api/password-reset/request", cfg.handlerRequestPasswordReset)
+	serveMux.HandleFunc("POST /api/password-reset/confirm", cfg.handlerConfirmPasswordReset)
 	serveMux.HandleFunc("POST /api/revoke", cfg.handlerRevoke)
-	serveMux.HandleFunc("PUT /api/users", cfg.handlerUpdateUser)
-	serveMux.HandleFunc("DELETE /api/chirps/{chirpID}", cfg.handlerDeleteChirp)
+	serveMux.Handle("PUT /api/users", cfg.middlewareScope(auth.ScopeProfileWrite, http.HandlerFunc(cfg.handlerUpdateUser)))
+	serveMux.Handle("PATCH /api/users", cfg.middlewareScope(auth.ScopeProfileWrite, http.HandlerFunc(cfg.handlerUpdateUser)))
+	serveMux.Handle("DELETE /api/users/me", cfg.middlewareAuth(http.HandlerFunc(cfg.handlerDeleteAccount)))
+	serveMux.Handle("POST /api/users/password", cfg.middlewareAuth(http.HandlerFunc(cfg.handlerChangePassword)))
+	serveMux.Handle("POST /api/users/email", cfg.middlewareAuth(http.HandlerFunc(cfg.handlerChangeEmail)))
+	serveMux.Handle("POST /api/users/me/export", cfg.middlewareAuth(http.HandlerFunc(cfg.handlerRequestDataExport)))
+	serveMux.Handle("GET /api/users/me/exports", cfg.middlewareAuth(http.HandlerFunc(cfg.handlerGetDataExports)))
+	serveMux.HandleFunc("GET /api/exports/{exportID}/download", cfg.handlerDownloadDataExport)
+	serveMux.HandleFunc("GET /api/users/email/confirm", cfg.handlerConfirmEmailChange)
+	serveMux.Handle("DELETE /api/chirps/{chirpID}", cfg.middlewareScope(auth.ScopeChirpsWrite, http.HandlerFunc(cfg.handlerDeleteChirp)))
 	serveMux.HandleFunc("POST /api/polka/webhooks", cfg.handlerPolkaWebhook)
+	serveMux.Handle("POST /api/chirps/{chirpID}/report", cfg.middlewareAuth(http.HandlerFunc(cfg.handlerReportChirp)))
+	serveMux.Handle("POST /api/users/{userID}/report", cfg.middlewareAuth(http.HandlerFunc(cfg.handlerReportUser)))
+	serveMux.Handle("GET /api/sessions", cfg.middlewareAuth(http.HandlerFunc(cfg.handlerGetSessions)))
+	serveMux.Handle("DELETE /api/sessions/{sessionID}", cfg.middlewareAuth(http.HandlerFunc(cfg.handlerDeleteSession)))
+	serveMux.Handle("POST /api/sessions/revoke-all", cfg.middlewareAuth(http.HandlerFunc(cfg.handlerRevokeAllSessions)))
+	serveMux.Handle("GET /api/tokens", cfg.middlewareAuth(http.HandlerFunc(cfg.handlerGetPersonalAccessTokens)))
+	serveMux.Handle("POST /api/tokens", cfg.middlewareAuth(http.HandlerFunc(cfg.handlerCreatePersonalAccessToken)))
+	serveMux.Handle("DELETE /api/tokens/{tokenID}", cfg.middlewareAuth(http.HandlerFunc(cfg.handlerRevokePersonalAccessToken)))
+	serveMux.Handle("GET /api/oauth/clients", cfg.middlewareAuth(http.HandlerFunc(cfg.handlerGetOAuthClients)))
+	serveMux.Handle("POST /api/oauth/clients", cfg.middlewareAuth(http.HandlerFunc(cfg.handlerCreateOAuthClient)))
+	serveMux.Handle("DELETE /api/oauth/clients/{clientID}", cfg.middlewareAuth(http.HandlerFunc(cfg.handlerDeleteOAuthClient)))
+	serveMux.HandleFunc("GET /oauth/authorize", cfg.oauth.HandleAuthorize)
+	serveMux.HandleFunc("POST /oauth/authorize", cfg.oauth.HandleAuthorizeDecision)
+	serveMux.HandleFunc("POST /oauth/token", cfg.oauth.HandleToken)
+	serveMux.HandleFunc("POST /oauth/introspect", cfg.oauth.HandleIntrospect)
+	serveMux.Handle("POST /api/logout", cfg.middlewareAuth(http.HandlerFunc(cfg.handlerLogout)))
+	serveMux.Handle("POST /api/users/2fa", cfg.middlewareAuth(http.HandlerFunc(cfg.handlerEnrollTwoFactor)))
+	serveMux.Handle("POST /api/users/2fa/confirm", cfg.middlewareAuth(http.HandlerFunc(cfg.handlerConfirmTwoFactor)))
+	serveMux.Handle("DELETE /api/users/2fa", cfg.middlewareAuth(http.HandlerFunc(cfg.handlerDisableTwoFactor)))
 
 	server := http.Server{
 		Addr:    ":8080",
@@ -1,19 +1,52 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, flagged, held_by, hold_reason)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3,
+    $4,
+    $5
 )
 RETURNING *;
 
 -- name: GetAllChirps :many
-SELECT * FROM chirps ORDER BY created_at;
+SELECT * FROM chirps WHERE NOT flagged AND NOT hidden ORDER BY created_at;
 
 -- name: GetChirpByID :one
 SELECT * FROM chirps WHERE id = $1;
 
 -- name: DeleteChirpByID :exec
 DELETE FROM chirps WHERE id = $1;
+
+-- name: HideChirpByID :exec
+UPDATE chirps SET updated_at = NOW(), hidden = true WHERE id = $1;
+
+-- name: GetAllChirpsFromActiveUsers :many
+SELECT chirps.* FROM chirps JOIN users ON chirps.user_id = users.id
+WHERE NOT chirps.flagged AND NOT chirps.hidden AND NOT users.banned
+AND (users.suspended_until IS NULL OR users.suspended_until < NOW())
+ORDER BY chirps.created_at;
+
+-- name: GetChirpsByUser :many
+SELECT * FROM chirps WHERE user_id = $1 ORDER BY created_at;
+
+-- name: GetChirpByIDFromActiveUser :one
+SELECT chirps.* FROM chirps JOIN users ON chirps.user_id = users.id
+WHERE chirps.id = $1 AND NOT users.banned
+AND (users.suspended_until IS NULL OR users.suspended_until < NOW());
+
+-- name: GetHeldChirps :many
+SELECT * FROM chirps WHERE flagged AND NOT hidden ORDER BY created_at;
+
+-- name: ApproveHeldChirp :one
+UPDATE chirps SET updated_at = NOW(), flagged = false
+WHERE id = $1 AND flagged AND NOT hidden
+RETURNING *;
+
+-- name: RejectHeldChirp :one
+UPDATE chirps SET updated_at = NOW(), hidden = true
+WHERE id = $1 AND flagged AND NOT hidden
+RETURNING *;
@@ -0,0 +1,41 @@
+-- name: CreateDataExport :one
+INSERT INTO data_exports (id, created_at, updated_at, user_id)
+SELECT gen_random_uuid(), NOW(), NOW(), $1
+WHERE NOT EXISTS (
+    SELECT 1 FROM data_exports
+    WHERE user_id = $1 AND status = 'ready' AND expires_at > NOW()
+)
+ON CONFLICT DO NOTHING
+RETURNING *;
+
+-- name: FinishDataExport :exec
+UPDATE data_exports SET updated_at = NOW(), status = 'ready', archive = $2, expires_at = $3
+WHERE id = $1;
+
+-- name: FailDataExport :exec
+UPDATE data_exports SET updated_at = NOW(), status = 'failed' WHERE id = $1;
+
+-- name: FailStaleDataExportsForUser :exec
+UPDATE data_exports SET updated_at = NOW(), status = 'failed'
+WHERE user_id = $1 AND status = 'pending' AND created_at < NOW() - INTERVAL '1 hour';
+
+-- name: GetDataExportByID :one
+SELECT * FROM data_exports WHERE id = $1;
+
+-- name: GetOpenDataExportForUser :one
+SELECT * FROM data_exports
+WHERE user_id = $1 AND (
+    (status = 'pending' AND created_at > NOW() - INTERVAL '1 hour')
+    OR (status = 'ready' AND expires_at > NOW())
+)
+ORDER BY created_at DESC
+LIMIT 1;
+
+-- name: GetDataExportsForUser :many
+SELECT id, created_at, updated_at, user_id, status, expires_at FROM data_exports
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: DeleteExpiredDataExports :execrows
+DELETE FROM data_exports
+WHERE expires_at < NOW() OR (status <> 'ready' AND created_at < NOW() - INTERVAL '1 day');
@@ -0,0 +1,17 @@
+-- name: CreateLoginChallenge :exec
+INSERT INTO login_challenges (token_hash, created_at, user_id, expires_at)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3
+);
+
+-- name: GetLoginChallenge :one
+SELECT * FROM login_challenges WHERE token_hash = $1 AND expires_at > NOW();
+
+-- name: IncrementLoginChallengeAttempts :one
+UPDATE login_challenges SET attempts = attempts + 1 WHERE token_hash = $1 RETURNING *;
+
+-- name: DeleteLoginChallenge :exec
+DELETE FROM login_challenges WHERE token_hash = $1;
@@ -0,0 +1,16 @@
+-- name: CreateModerationAction :one
+INSERT INTO moderation_actions (id, created_at, moderator_id, report_id, action, chirp_id, user_id, note)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+)
+RETURNING *;
+
+-- name: GetAllModerationActions :many
+SELECT * FROM moderation_actions ORDER BY created_at DESC;
@@ -0,0 +1,18 @@
+-- name: UpsertModerationWord :one
+INSERT INTO moderation_words (id, created_at, updated_at, word, action, language)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3
+)
+ON CONFLICT (word) DO UPDATE SET updated_at = NOW(), action = EXCLUDED.action, language = EXCLUDED.language
+RETURNING *;
+
+-- name: GetAllModerationWords :many
+SELECT * FROM moderation_words ORDER BY word;
+
+-- name: DeleteModerationWordByID :one
+DELETE FROM moderation_words WHERE id = $1 RETURNING *;
@@ -0,0 +1,22 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, created_at, updated_at, owner_id, name, secret_hash, redirect_uris, scopes)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+RETURNING *;
+
+-- name: GetOAuthClientByID :one
+SELECT * FROM oauth_clients WHERE id = $1;
+
+-- name: GetOAuthClientsForOwner :many
+SELECT * FROM oauth_clients WHERE owner_id = $1 ORDER BY created_at DESC;
+
+-- name: DeleteOAuthClientForOwner :execrows
+DELETE FROM oauth_clients WHERE id = $1 AND owner_id = $2;
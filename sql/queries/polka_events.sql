@@ -0,0 +1,10 @@
+-- name: RecordPolkaEvent :execrows
+INSERT INTO polka_events (id, received_at)
+VALUES (
+    $1,
+    NOW()
+)
+ON CONFLICT (id) DO NOTHING;
+
+-- name: DeleteOldPolkaEvents :exec
+DELETE FROM polka_events WHERE received_at < NOW() - INTERVAL '30 days';
@@ -0,0 +1,17 @@
+-- name: CreateRecoveryCode :exec
+INSERT INTO recovery_codes (id, created_at, user_id, code_hash)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2
+);
+
+-- name: GetUnusedRecoveryCodesForUser :many
+SELECT * FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL;
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes SET used_at = NOW() WHERE id = $1 AND used_at IS NULL;
+
+-- name: DeleteRecoveryCodesForUser :exec
+DELETE FROM recovery_codes WHERE user_id = $1;
@@ -1,16 +1,60 @@
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at)
+INSERT INTO refresh_tokens (token_hash, token_prefix, created_at, updated_at, user_id, expires_at, family_id, user_agent, ip_address, last_used_at)
 VALUES (
     $1,
+    $2,
     NOW(),
     NOW(),
-    $2,
-    $3
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    NOW()
 )
 RETURNING *;
 
--- name: GetRefreshTokenByToken :one
-SELECT * FROM refresh_tokens WHERE token = $1;
+-- name: GetRefreshTokensByPrefix :many
+SELECT * FROM refresh_tokens WHERE token_prefix = $1;
 
 -- name: RevokeRefreshToken :exec
-UPDATE refresh_tokens SET updated_at = NOW(), revoked_at = NOW() WHERE token = $1;
+UPDATE refresh_tokens SET updated_at = NOW(), revoked_at = NOW() WHERE token_hash = $1;
+
+-- name: RotateRefreshToken :one
+UPDATE refresh_tokens SET updated_at = NOW(), replaced_by = $2
+WHERE token_hash = $1 AND replaced_by IS NULL AND revoked_at IS NULL
+RETURNING *;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens SET updated_at = NOW(), revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: GetActiveRefreshTokensForUser :many
+SELECT * FROM refresh_tokens
+WHERE user_id = $1 AND revoked_at IS NULL AND replaced_by IS NULL AND expires_at > NOW()
+ORDER BY last_used_at DESC;
+
+-- name: RevokeRefreshTokenFamilyForUser :execrows
+UPDATE refresh_tokens SET updated_at = NOW(), revoked_at = NOW()
+WHERE family_id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeAllRefreshTokensForUser :exec
+UPDATE refresh_tokens SET updated_at = NOW(), revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: CreateClientRefreshToken :one
+INSERT INTO refresh_tokens (token_hash, token_prefix, created_at, updated_at, user_id, expires_at, family_id, client_id, scopes, last_used_at)
+VALUES (
+    $1,
+    $2,
+    NOW(),
+    NOW(),
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    NOW()
+)
+RETURNING *;
+
+-- name: GetRefreshTokensForUser :many
+SELECT * FROM refresh_tokens WHERE user_id = $1 ORDER BY created_at;
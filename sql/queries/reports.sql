@@ -0,0 +1,32 @@
+-- name: CreateReport :one
+INSERT INTO reports (id, created_at, updated_at, reporter_id, chirp_id, reported_user_id, reason, details)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+RETURNING *;
+
+-- name: GetReportsByStatus :many
+SELECT * FROM reports WHERE status = $1 ORDER BY created_at;
+
+-- name: ClaimReport :one
+UPDATE reports SET updated_at = NOW(), status = 'claimed', claimed_by = $2, claimed_at = NOW()
+WHERE id = $1 AND status = 'open'
+RETURNING *;
+
+-- name: ResolveReport :one
+UPDATE reports SET updated_at = NOW(), status = 'resolved', resolution = $2, resolved_at = NOW()
+WHERE id = $1 AND status = 'claimed' AND claimed_by = $3
+RETURNING *;
+
+-- name: GetReportByID :one
+SELECT * FROM reports WHERE id = $1;
+
+-- name: GetReportsByReporter :many
+SELECT * FROM reports WHERE reporter_id = $1 ORDER BY created_at;
@@ -0,0 +1,15 @@
+-- name: CreateRevokedAccessToken :exec
+INSERT INTO revoked_access_tokens (jti, created_at, user_id, expires_at)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3
+)
+ON CONFLICT (jti) DO NOTHING;
+
+-- name: GetUnexpiredRevokedAccessTokens :many
+SELECT * FROM revoked_access_tokens WHERE expires_at > NOW();
+
+-- name: DeleteExpiredRevokedAccessTokens :exec
+DELETE FROM revoked_access_tokens WHERE expires_at <= NOW();
@@ -0,0 +1,35 @@
+-- name: SaveSubscription :exec
+INSERT INTO subscriptions (id, created_at, updated_at, user_id, status, started_at, current_period_end, cancelled_at, last_event_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+)
+ON CONFLICT (user_id) DO UPDATE SET
+    updated_at = NOW(),
+    status = EXCLUDED.status,
+    started_at = EXCLUDED.started_at,
+    current_period_end = EXCLUDED.current_period_end,
+    cancelled_at = EXCLUDED.cancelled_at,
+    last_event_at = EXCLUDED.last_event_at;
+
+-- name: GetSubscriptionForUser :one
+SELECT * FROM subscriptions WHERE user_id = $1;
+
+-- name: LockSubscriptionForUser :one
+SELECT * FROM subscriptions WHERE user_id = $1 FOR UPDATE;
+
+-- name: ExpireSubscriptions :execrows
+WITH expired AS (
+    UPDATE subscriptions SET updated_at = NOW(), status = 'expired'
+    WHERE status <> 'expired' AND current_period_end < NOW()
+    RETURNING user_id
+)
+UPDATE users SET updated_at = NOW(), is_chirpy_red = false
+WHERE id IN (SELECT user_id FROM expired);
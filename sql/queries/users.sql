@@ -16,10 +16,80 @@ DELETE FROM users;
 SELECT * FROM users WHERE email = $1;
 
 -- name: GetUserFromRefreshToken :one
-SELECT * FROM users JOIN refresh_tokens ON users.id = refresh_tokens.user_id WHERE refresh_tokens.token = $1;
+SELECT * FROM users JOIN refresh_tokens ON users.id = refresh_tokens.user_id WHERE refresh_tokens.token_hash = $1;
 
--- name: UpdateUserWithID :one
-UPDATE users SET updated_at = NOW(), hashed_password = $2, email = $3 WHERE id = $1 RETURNING *;
+-- name: SetChirpyRedUserWithID :one
+UPDATE users SET updated_at = NOW(), is_chirpy_red = $2 WHERE id = $1 RETURNING *;
 
--- name: PromoteToRedUserWithID :one
-UPDATE users SET is_chirpy_red = true WHERE id = $1 RETURNING *;
+-- name: GetUserByID :one
+SELECT * FROM users WHERE id = $1;
+
+-- name: SuspendUserWithID :one
+UPDATE users SET updated_at = NOW(), suspended_until = $2 WHERE id = $1 RETURNING *;
+
+-- name: SetBannedUserWithID :one
+UPDATE users SET updated_at = NOW(), banned = $2 WHERE id = $1 RETURNING *;
+
+-- name: SetRoleUserWithID :one
+UPDATE users SET updated_at = NOW(), role = $2 WHERE id = $1 RETURNING *;
+
+-- name: SetTokensIssuedBeforeUserWithID :exec
+UPDATE users SET updated_at = NOW(), tokens_issued_before = $2 WHERE id = $1;
+
+-- name: GetTokensIssuedBefore :many
+SELECT id, tokens_issued_before FROM users WHERE tokens_issued_before IS NOT NULL;
+
+-- name: SetTOTPSecretUserWithID :one
+UPDATE users SET updated_at = NOW(), totp_secret = $2, totp_enabled = false WHERE id = $1 RETURNING *;
+
+-- name: EnableTOTPUserWithID :exec
+UPDATE users SET updated_at = NOW(), totp_enabled = true, totp_last_counter = $2 WHERE id = $1;
+
+-- name: DisableTOTPUserWithID :exec
+UPDATE users SET updated_at = NOW(), totp_secret = NULL, totp_enabled = false, totp_last_counter = 0 WHERE id = $1;
+
+-- name: SetTOTPLastCounterUserWithID :execrows
+UPDATE users SET totp_last_counter = $2 WHERE id = $1 AND totp_last_counter < $2;
+
+-- name: RehashPasswordUserWithID :exec
+UPDATE users SET hashed_password = $2 WHERE id = $1;
+
+-- name: ClaimLoginAttemptUserWithID :one
+UPDATE users SET failed_login_attempts = failed_login_attempts + 1, last_failed_login_at = NOW(), login_blocked_until = $2
+WHERE id = $1 AND (login_blocked_until IS NULL OR login_blocked_until <= NOW())
+RETURNING *;
+
+-- name: ExtendLoginBlockUserWithID :exec
+UPDATE users SET login_blocked_until = $2 WHERE id = $1 AND login_blocked_until < $2;
+
+-- name: ReleaseLoginAttemptUserWithID :exec
+UPDATE users SET failed_login_attempts = failed_login_attempts - 1 WHERE id = $1 AND failed_login_attempts > 0;
+
+-- name: ForgetExpiredFailedLoginsUserWithID :exec
+UPDATE users SET failed_login_attempts = 0, last_failed_login_at = NULL, login_blocked_until = NULL WHERE id = $1 AND last_failed_login_at < $2;
+
+-- name: ResetFailedLoginsUserWithID :one
+UPDATE users SET failed_login_attempts = 0, last_failed_login_at = NULL, login_blocked_until = NULL WHERE id = $1 RETURNING *;
+
+-- name: SetEmailVerifiedUserWithID :one
+UPDATE users SET updated_at = NOW(), email_verified_at = NOW() WHERE id = $1 AND email = $2 RETURNING *;
+
+-- name: UpdatePasswordUserWithID :one
+UPDATE users SET updated_at = NOW(), hashed_password = $2 WHERE id = $1 RETURNING *;
+
+-- name: SetPendingEmailUserWithID :exec
+UPDATE users SET updated_at = NOW(), pending_email = $2 WHERE id = $1;
+
+-- name: ConfirmPendingEmailUserWithID :one
+UPDATE users SET updated_at = NOW(), email = pending_email, pending_email = NULL, email_verified_at = NOW()
+WHERE id = $1 AND pending_email = $2
+RETURNING *;
+
+-- name: RequestDeletionUserWithID :one
+UPDATE users SET updated_at = NOW(), deletion_requested_at = NOW() WHERE id = $1 RETURNING *;
+
+-- name: CancelDeletionUserWithID :exec
+UPDATE users SET updated_at = NOW(), deletion_requested_at = NULL WHERE id = $1;
+
+-- name: DeleteUsersRequestedBefore :execrows
+DELETE FROM users WHERE deletion_requested_at < $1;
@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE moderation_words (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    word TEXT NOT NULL UNIQUE,
+    action TEXT NOT NULL DEFAULT 'mask' CHECK (action IN ('mask', 'reject', 'flag')),
+    language TEXT NULL
+);
+
+INSERT INTO moderation_words (id, created_at, updated_at, word, action)
+VALUES
+    (gen_random_uuid(), NOW(), NOW(), 'kerfuffle', 'mask'),
+    (gen_random_uuid(), NOW(), NOW(), 'sharbert', 'mask'),
+    (gen_random_uuid(), NOW(), NOW(), 'fornax', 'mask');
+
+-- +goose Down
+DROP TABLE moderation_words;
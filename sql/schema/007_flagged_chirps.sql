@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN flagged BOOL NOT NULL DEFAULT FALSE;
+
+-- +goose Down
+ALTER TABLE chirps
+DROP COLUMN flagged;
@@ -0,0 +1,24 @@
+-- +goose Up
+CREATE TABLE reports (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    reporter_id UUID NOT NULL,
+    chirp_id UUID NULL,
+    reported_user_id UUID NULL,
+    reason TEXT NOT NULL CHECK (reason IN ('spam', 'harassment', 'hate_speech', 'violence', 'misinformation', 'other')),
+    details TEXT NULL,
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'claimed', 'resolved')),
+    claimed_by UUID NULL,
+    claimed_at TIMESTAMP NULL,
+    resolution TEXT NULL CHECK (resolution IN ('dismiss', 'hide_chirp', 'suspend_user')),
+    resolved_at TIMESTAMP NULL,
+    FOREIGN KEY (reporter_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (chirp_id) REFERENCES chirps (id) ON DELETE CASCADE,
+    FOREIGN KEY (reported_user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (claimed_by) REFERENCES users (id) ON DELETE SET NULL,
+    CHECK (chirp_id IS NOT NULL OR reported_user_id IS NOT NULL)
+);
+
+-- +goose Down
+DROP TABLE reports;
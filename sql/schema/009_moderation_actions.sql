@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE moderation_actions (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    moderator_id UUID NULL,
+    report_id UUID NULL,
+    action TEXT NOT NULL,
+    chirp_id UUID NULL,
+    user_id UUID NULL,
+    note TEXT NULL,
+    FOREIGN KEY (moderator_id) REFERENCES users (id) ON DELETE SET NULL,
+    FOREIGN KEY (report_id) REFERENCES reports (id) ON DELETE SET NULL
+);
+
+-- +goose Down
+DROP TABLE moderation_actions;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN hidden BOOL NOT NULL DEFAULT FALSE;
+
+-- +goose Down
+ALTER TABLE chirps
+DROP COLUMN hidden;
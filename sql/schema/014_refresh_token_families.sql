@@ -0,0 +1,14 @@
+-- +goose Up
+ALTER TABLE refresh_tokens
+ADD COLUMN family_id UUID NULL,
+ADD COLUMN replaced_by TEXT NULL;
+
+UPDATE refresh_tokens SET family_id = gen_random_uuid();
+
+ALTER TABLE refresh_tokens
+ALTER COLUMN family_id SET NOT NULL;
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+DROP COLUMN family_id,
+DROP COLUMN replaced_by;
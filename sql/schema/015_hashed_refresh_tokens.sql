@@ -0,0 +1,21 @@
+-- +goose Up
+DELETE FROM refresh_tokens;
+
+ALTER TABLE refresh_tokens
+RENAME COLUMN token TO token_hash;
+
+ALTER TABLE refresh_tokens
+ADD COLUMN token_prefix TEXT NOT NULL;
+
+CREATE INDEX refresh_tokens_token_prefix_idx ON refresh_tokens (token_prefix);
+
+-- +goose Down
+DELETE FROM refresh_tokens;
+
+DROP INDEX refresh_tokens_token_prefix_idx;
+
+ALTER TABLE refresh_tokens
+DROP COLUMN token_prefix;
+
+ALTER TABLE refresh_tokens
+RENAME COLUMN token_hash TO token;
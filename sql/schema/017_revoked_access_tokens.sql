@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE revoked_access_tokens (
+    jti TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+ALTER TABLE users
+ADD COLUMN tokens_issued_before TIMESTAMP NULL;
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN tokens_issued_before;
+
+DROP TABLE revoked_access_tokens;
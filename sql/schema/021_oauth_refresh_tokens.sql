@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE refresh_tokens
+ADD COLUMN client_id UUID NULL REFERENCES oauth_clients (id) ON DELETE CASCADE,
+ADD COLUMN scopes TEXT NULL;
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+DROP COLUMN client_id,
+DROP COLUMN scopes;
@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN totp_secret TEXT NULL,
+ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT false,
+ADD COLUMN totp_last_counter BIGINT NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN totp_secret,
+DROP COLUMN totp_enabled,
+DROP COLUMN totp_last_counter;
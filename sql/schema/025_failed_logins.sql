@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN failed_login_attempts INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN last_failed_login_at TIMESTAMP NULL;
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN failed_login_attempts,
+DROP COLUMN last_failed_login_at;
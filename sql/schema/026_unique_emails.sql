@@ -0,0 +1,19 @@
+-- +goose Up
+-- emails are compared case-insensitively and stored lowercased. Where that
+-- makes addresses collide, the oldest account keeps the address and the
+-- others get a unique placeholder based on it, to be sorted out by an admin
+-- or through support:
+--   SELECT id, email FROM users WHERE email LIKE '%.duplicate-%';
+UPDATE users SET email = CASE
+    WHEN ranked.n = 1 THEN LOWER(TRIM(users.email))
+    ELSE LOWER(TRIM(users.email)) || '.duplicate-' || users.id
+END
+FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY LOWER(TRIM(email)) ORDER BY created_at, id) AS n
+    FROM users
+) AS ranked
+WHERE users.id = ranked.id;
+CREATE UNIQUE INDEX users_email_idx ON users (email);
+
+-- +goose Down
+DROP INDEX users_email_idx;
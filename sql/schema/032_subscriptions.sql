@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TABLE subscriptions (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL UNIQUE,
+    status TEXT NOT NULL,
+    started_at TIMESTAMP NOT NULL,
+    current_period_end TIMESTAMP NOT NULL,
+    cancelled_at TIMESTAMP NULL,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+-- members from before subscriptions existed get a period to be renewed in
+INSERT INTO subscriptions (id, created_at, updated_at, user_id, status, started_at, current_period_end)
+SELECT gen_random_uuid(), NOW(), NOW(), id, 'active', updated_at, NOW() + INTERVAL '30 days'
+FROM users WHERE is_chirpy_red;
+
+-- +goose Down
+DROP TABLE subscriptions;
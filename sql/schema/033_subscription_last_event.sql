@@ -0,0 +1,10 @@
+-- +goose Up
+ALTER TABLE subscriptions
+ADD COLUMN last_event_at TIMESTAMP NULL;
+UPDATE subscriptions SET last_event_at = updated_at;
+ALTER TABLE subscriptions
+ALTER COLUMN last_event_at SET NOT NULL;
+
+-- +goose Down
+ALTER TABLE subscriptions
+DROP COLUMN last_event_at;
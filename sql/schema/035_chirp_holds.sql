@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN held_by TEXT NULL,
+ADD COLUMN hold_reason TEXT NULL;
+
+-- +goose Down
+ALTER TABLE chirps
+DROP COLUMN held_by,
+DROP COLUMN hold_reason;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN login_blocked_until TIMESTAMP NULL;
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN login_blocked_until;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- a user has at most one export being prepared. Older duplicates are given
+-- up on.
+UPDATE data_exports SET updated_at = NOW(), status = 'failed'
+FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY created_at DESC, id) AS n
+    FROM data_exports
+    WHERE status = 'pending'
+) AS ranked
+WHERE data_exports.id = ranked.id AND ranked.n > 1;
+CREATE UNIQUE INDEX data_exports_pending_idx ON data_exports (user_id) WHERE status = 'pending';
+
+-- +goose Down
+DROP INDEX data_exports_pending_idx;